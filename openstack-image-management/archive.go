@@ -0,0 +1,73 @@
+package openstackimagemanagement
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	gopenstack "github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imagedata"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
+)
+
+const (
+	archiveFailureSkip   = "skip"
+	archiveFailureDelete = "delete"
+)
+
+// archiveImage streams the data of an image to the archive_to_swift
+// container, and verifies the upload against the MD5 of the streamed data
+// and the Glance checksum.
+func (p *OpenStackPostProcessor) archiveImage(img images.Image) (string, error) {
+	if p.objectStorage == nil {
+		client, err := gopenstack.NewObjectStorageV1(p.conn.ProviderClient, gophercloud.EndpointOpts{
+			Region: p.config.Region,
+		})
+		if err != nil {
+			return "", err
+		}
+		p.objectStorage = client
+	}
+
+	body, err := imagedata.Download(p.conn, img.ID).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to download image data: %s", err)
+	}
+	defer body.Close()
+
+	name := p.config.ArchivePrefix + img.ID
+	hash := md5.New()
+	opts := objects.CreateOpts{
+		Content:     io.TeeReader(body, hash),
+		ContentType: "application/octet-stream",
+		Metadata: map[string]string{
+			"Image-Name":       img.Name,
+			"Image-Created-At": imageCreatedAt(img).UTC().Format(time.RFC3339),
+			"Disk-Format":      img.DiskFormat,
+		},
+	}
+	if img.Checksum != "" {
+		// Let Swift verify the upload while streaming it.
+		opts.ETag = img.Checksum
+	} else {
+		opts.NoETag = true
+	}
+
+	header, err := objects.Create(p.objectStorage, p.config.ArchiveToSwift, name, opts).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s/%s: %s", p.config.ArchiveToSwift, name, err)
+	}
+
+	sum := fmt.Sprintf("%x", hash.Sum(nil))
+	if header.ETag != sum {
+		return "", fmt.Errorf("uploaded %s/%s has ETag %s, expected %s", p.config.ArchiveToSwift, name, header.ETag, sum)
+	}
+	if img.Checksum != "" && img.Checksum != sum {
+		return "", fmt.Errorf("downloaded data has MD5 %s, expected the image checksum %s", sum, img.Checksum)
+	}
+
+	return p.config.ArchiveToSwift + "/" + name, nil
+}
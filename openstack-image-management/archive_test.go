@@ -0,0 +1,113 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+const testArchiveData = "archived image data"
+
+// archiveHandler serves the image data and records the uploaded objects.
+// The ETag answered for uploads is the given one, or the MD5 of the upload.
+func archiveHandler(t *testing.T, imageID, etag string) map[string]string {
+	uploads := make(map[string]string)
+
+	th.Mux.HandleFunc(fmt.Sprintf("/images/%s/file", imageID), func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, testArchiveData)
+	})
+	th.Mux.HandleFunc("/backups/image-"+imageID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "PUT")
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("err: %s", err)
+		}
+		uploads[r.URL.Path] = string(b)
+		if etag == "" {
+			etag = fmt.Sprintf("%x", md5.Sum(b))
+		}
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	return uploads
+}
+
+func TestArchiveImage(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	uploads := archiveHandler(t, "07aa21a9-fa1a-430e-9a33-185be5982431", "")
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient(), objectStorage: fakeclient.ServiceClient()}
+	p.config.ArchiveToSwift = "backups"
+	p.config.ArchivePrefix = "image-"
+	img := images.Image{
+		ID:       "07aa21a9-fa1a-430e-9a33-185be5982431",
+		Checksum: fmt.Sprintf("%x", md5.Sum([]byte(testArchiveData))),
+	}
+	object, err := p.archiveImage(img)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if object != "backups/image-07aa21a9-fa1a-430e-9a33-185be5982431" {
+		t.Fatalf("unexpected object: %s", object)
+	}
+	if uploads["/backups/image-07aa21a9-fa1a-430e-9a33-185be5982431"] != testArchiveData {
+		t.Fatalf("unexpected uploads: %v", uploads)
+	}
+}
+
+func TestArchiveImageETagMismatch(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	archiveHandler(t, "07aa21a9-fa1a-430e-9a33-185be5982431", "0123456789abcdef0123456789abcdef")
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient(), objectStorage: fakeclient.ServiceClient()}
+	p.config.ArchiveToSwift = "backups"
+	p.config.ArchivePrefix = "image-"
+	_, err := p.archiveImage(images.Image{ID: "07aa21a9-fa1a-430e-9a33-185be5982431"})
+	if err == nil || !strings.Contains(err.Error(), "has ETag 0123456789abcdef0123456789abcdef") {
+		t.Fatalf("should detect the mismatch: %v", err)
+	}
+}
+
+func TestPostProcessorArchiveOnFailure(t *testing.T) {
+	for _, onFailure := range []string{archiveFailureSkip, archiveFailureDelete} {
+		t.Run(onFailure, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			calls := ImageListHandler(t, imgs)
+			archiveHandler(t, "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4", "0123456789abcdef0123456789abcdef")
+
+			p := OpenStackPostProcessor{conn: fakeclient.ServiceClient(), objectStorage: fakeclient.ServiceClient()}
+			p.config.Identifier = "packer-example"
+			p.config.KeepReleases = 2
+			p.config.ArchiveToSwift = "backups"
+			p.config.ArchivePrefix = "image-"
+			p.config.ArchiveOnFailure = onFailure
+			if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			deleted := len(calls.Deleted) == 1
+			if deleted != (onFailure == archiveFailureDelete) {
+				t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package openstackimagemanagement
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// checkpoint records the IDs of the images deleted so far in the
+// checkpoint_file, one per line, so that an interrupted run can be resumed.
+type checkpoint struct {
+	path    string
+	deleted map[string]bool
+}
+
+// loadCheckpoint reads the checkpoint file. A missing file is an empty
+// checkpoint.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{path: path, deleted: make(map[string]bool)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			c.deleted[id] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %s", path, err)
+	}
+	return c, nil
+}
+
+// Deleted reports whether the image was recorded as deleted.
+func (c *checkpoint) Deleted(id string) bool {
+	return c.deleted[id]
+}
+
+// Record appends a deleted image to the checkpoint file.
+func (c *checkpoint) Record(id string) error {
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, id); err != nil {
+		f.Close()
+		return err
+	}
+	c.deleted[id] = true
+	return f.Close()
+}
@@ -0,0 +1,104 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessorCheckpointFile(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint")
+	if err := ioutil.WriteFile(path, []byte("e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.CheckpointFile = path
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "8c64f48a-45a3-4eaa-adff-a8106b6c005b" {
+		t.Fatalf("images in the checkpoint should be skipped: %v", calls.Deleted)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint should be removed once the run completed")
+	}
+}
+
+func TestPostProcessorCheckpointFileAlreadyDeleted(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	th.Mux.HandleFunc("/images", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"images": [%s, %s]}`, imgs[0].JSON, imgs[1].JSON)
+	})
+	th.Mux.HandleFunc("/images/8c64f48a-45a3-4eaa-adff-a8106b6c005b", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "DELETE")
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.RemoveProperties = []string{}
+	p.config.CheckpointFile = filepath.Join(dir, "checkpoint")
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("an image deleted in the meantime should count as deleted: %s", err)
+	}
+}
+
+func TestCheckpointRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint")
+	c, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := c.Record(id); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	c, err = loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !c.Deleted("a") || !c.Deleted("b") || c.Deleted("c") {
+		t.Fatalf("unexpected checkpoint: %v", c.deleted)
+	}
+}
@@ -0,0 +1,53 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The ci_output_format values.
+const (
+	ciOutputGitHub = "github"
+	ciOutputGitLab = "gitlab"
+)
+
+// writeCIOutput appends the results of the run as step outputs to the
+// ci_output_file, or for GitHub Actions to the file named by GITHUB_OUTPUT.
+// GitLab has no step outputs, so the variables are written for a dotenv
+// report instead, prefixed with IMAGE_MANAGEMENT_.
+func (p *OpenStackPostProcessor) writeCIOutput(actions *actionEmitter, newestID string) error {
+	path := p.config.CIOutputFile
+	if path == "" && p.config.CIOutputFormat == ciOutputGitHub {
+		path = os.Getenv("GITHUB_OUTPUT")
+	}
+	if path == "" {
+		return fmt.Errorf("ci_output_format %s requires ci_output_file or GITHUB_OUTPUT to be set", p.config.CIOutputFormat)
+	}
+
+	outputs := []struct {
+		name  string
+		value string
+	}{
+		{"deleted", fmt.Sprint(actions.Count(actionDelete))},
+		{"kept", fmt.Sprint(actions.Count(actionKeep))},
+		{"skipped", fmt.Sprint(actions.Count(actionSkip))},
+		{"newest_image_id", newestID},
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	for _, output := range outputs {
+		name := output.name
+		if p.config.CIOutputFormat == ciOutputGitLab {
+			name = "IMAGE_MANAGEMENT_" + strings.ToUpper(name)
+		}
+		if _, err := fmt.Fprintf(f, "%s=%s\n", name, output.value); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
@@ -0,0 +1,74 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessorCIOutputGitHub(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "ci")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "output")
+	if err := ioutil.WriteFile(path, []byte("previous=step\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Setenv("GITHUB_OUTPUT", path)
+	defer os.Unsetenv("GITHUB_OUTPUT")
+
+	ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 2
+	p.config.CIOutputFormat = ciOutputGitHub
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := "previous=step\ndeleted=1\nkept=2\nskipped=0\nnewest_image_id=07aa21a9-fa1a-430e-9a33-185be5982431\n"
+	if string(b) != expected {
+		t.Fatalf("unexpected outputs:\n%s", b)
+	}
+}
+
+func TestWriteCIOutputGitLab(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ci")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var p OpenStackPostProcessor
+	p.config.CIOutputFormat = ciOutputGitLab
+	p.config.CIOutputFile = filepath.Join(dir, "image-management.env")
+	if err := p.writeCIOutput(&actionEmitter{}, "id"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(p.config.CIOutputFile)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := "IMAGE_MANAGEMENT_DELETED=0\nIMAGE_MANAGEMENT_KEPT=0\nIMAGE_MANAGEMENT_SKIPPED=0\nIMAGE_MANAGEMENT_NEWEST_IMAGE_ID=id\n"
+	if string(b) != expected {
+		t.Fatalf("unexpected outputs:\n%s", b)
+	}
+}
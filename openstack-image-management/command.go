@@ -0,0 +1,34 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	onFailureError = "error"
+	onFailureWarn  = "warn"
+)
+
+// runPostRunCommand runs the configured command with the report path as its
+// last argument and the run's counts in the environment.
+func runPostRunCommand(ctx context.Context, command []string, reportPath string, r *report) (string, error) {
+	args := append(append([]string{}, command[1:]...), reportPath)
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.Env = append(os.Environ(),
+		"PACKER_IMAGE_MANAGEMENT_IDENTIFIER="+r.Identifier,
+		fmt.Sprintf("PACKER_IMAGE_MANAGEMENT_KEPT=%d", r.Kept),
+		fmt.Sprintf("PACKER_IMAGE_MANAGEMENT_DELETED=%d", r.Deleted),
+		fmt.Sprintf("PACKER_IMAGE_MANAGEMENT_SKIPPED=%d", r.Skipped),
+		"PACKER_IMAGE_MANAGEMENT_REPORT="+reportPath,
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("post_run_command %q failed: %s", strings.Join(command, " "), err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,70 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer/packer"
+)
+
+// manageCurrent marks the current image with the current_tag and
+// current_property, and removes them from every other managed image, for
+// manage_current_only.
+func (p *OpenStackPostProcessor) manageCurrent(ui packer.Ui, managed []images.Image, current images.Image) error {
+	ui.Message(fmt.Sprintf("Marking image as current: %s %s", current.Name, current.ID))
+	for _, img := range managed {
+		updateOpts := p.currentUpdateOpts(img, img.ID == current.ID)
+		if len(updateOpts) == 0 {
+			log.Printf("Current marker of image is up to date (%s) (%s)", img.Name, img.ID)
+			continue
+		}
+		if img.ID != current.ID {
+			ui.Message(fmt.Sprintf("Removing current marker from image: %s %s", img.Name, img.ID))
+		}
+		if err := p.withReauth(func() error { return images.Update(p.conn, img.ID, updateOpts).Err }); err != nil {
+			return fmt.Errorf("failed to update current marker of image %s: %s", img.ID, err)
+		}
+	}
+	return nil
+}
+
+// currentUpdateOpts returns the updates adding the current marker to an
+// image, or removing it from an image that is not current.
+func (p *OpenStackPostProcessor) currentUpdateOpts(img images.Image, current bool) images.UpdateOpts {
+	var updateOpts images.UpdateOpts
+
+	if tag := p.config.CurrentTag; tag != "" {
+		var tags []string
+		tagged := false
+		for _, t := range img.Tags {
+			if t == tag {
+				tagged = true
+				if !current {
+					continue
+				}
+			}
+			tags = append(tags, t)
+		}
+		if current && !tagged {
+			tags = append(tags, tag)
+		}
+		if current != tagged {
+			updateOpts = append(updateOpts, images.ReplaceImageTags{NewTags: tags})
+		}
+	}
+
+	if name := p.config.CurrentProperty; name != "" {
+		v, ok := img.Properties[name]
+		switch {
+		case current && !ok:
+			updateOpts = append(updateOpts, images.UpdateImageProperty{Op: images.AddOp, Name: name, Value: p.config.CurrentValue})
+		case current && fmt.Sprint(v) != p.config.CurrentValue:
+			updateOpts = append(updateOpts, images.UpdateImageProperty{Op: images.ReplaceOp, Name: name, Value: p.config.CurrentValue})
+		case !current && ok:
+			updateOpts = append(updateOpts, images.UpdateImageProperty{Op: images.RemoveOp, Name: name})
+		}
+	}
+
+	return updateOpts
+}
@@ -0,0 +1,69 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessorManageCurrentOnly(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	previous := imgs[1]
+	previous.JSON = strings.Replace(previous.JSON, `"tags": []`, `"tags": ["current"]`, 1)
+	calls := ImageListHandler(t, []imageEntry{imgs[0], previous, imgs[2]})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.ManageCurrentOnly = true
+	p.config.CurrentTag = "current"
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Join(calls.Updated, ",") != "07aa21a9-fa1a-430e-9a33-185be5982431,8c64f48a-45a3-4eaa-adff-a8106b6c005b" {
+		t.Fatalf("should only move the current tag: %v", calls.Updated)
+	}
+	if len(calls.Deleted) != 0 {
+		t.Fatalf("should not delete anything: %v", calls.Deleted)
+	}
+}
+
+func TestCurrentUpdateOpts(t *testing.T) {
+	var p OpenStackPostProcessor
+	p.config.CurrentTag = "current"
+	p.config.CurrentProperty = "release"
+	p.config.CurrentValue = "current"
+
+	img := images.Image{Tags: []string{"base"}, Properties: map[string]interface{}{"release": "previous"}}
+	updateOpts := p.currentUpdateOpts(img, true)
+	expected := images.UpdateOpts{
+		images.ReplaceImageTags{NewTags: []string{"base", "current"}},
+		images.UpdateImageProperty{Op: images.ReplaceOp, Name: "release", Value: "current"},
+	}
+	if !reflect.DeepEqual(updateOpts, expected) {
+		t.Fatalf("unexpected updates: %#v", updateOpts)
+	}
+
+	img = images.Image{Tags: []string{"base", "current"}, Properties: map[string]interface{}{"release": "current"}}
+	if updateOpts := p.currentUpdateOpts(img, true); len(updateOpts) != 0 {
+		t.Fatalf("should not update the current image again: %#v", updateOpts)
+	}
+
+	updateOpts = p.currentUpdateOpts(img, false)
+	expected = images.UpdateOpts{
+		images.ReplaceImageTags{NewTags: []string{"base"}},
+		images.UpdateImageProperty{Op: images.RemoveOp, Name: "release"},
+	}
+	if !reflect.DeepEqual(updateOpts, expected) {
+		t.Fatalf("unexpected updates: %#v", updateOpts)
+	}
+}
@@ -0,0 +1,267 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// deleteExpression is a parsed delete_expression. It is a Go expression
+// limited to literals, identifiers, comparisons, !, && and ||, and
+// property("name") calls, so that evaluating it has no side effects.
+type deleteExpression struct {
+	source string
+	expr   ast.Expr
+}
+
+// parseDeleteExpression parses and checks a delete_expression.
+func parseDeleteExpression(source string) (*deleteExpression, error) {
+	expr, err := parser.ParseExpr(source)
+	if err != nil {
+		return nil, fmt.Errorf("delete_expression: %s", err)
+	}
+	if err := checkExpression(expr); err != nil {
+		return nil, fmt.Errorf("delete_expression: %s", err)
+	}
+	return &deleteExpression{source: source, expr: expr}, nil
+}
+
+func checkExpression(expr ast.Expr) error {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING && e.Kind != token.INT && e.Kind != token.FLOAT {
+			return fmt.Errorf("unsupported literal %s", e.Value)
+		}
+		if e.Kind != token.STRING {
+			// Go accepts number literals that evaluation cannot parse.
+			if _, err := strconv.ParseFloat(e.Value, 64); err != nil {
+				return fmt.Errorf("unsupported number %s", e.Value)
+			}
+		}
+	case *ast.Ident:
+	case *ast.ParenExpr:
+		return checkExpression(e.X)
+	case *ast.UnaryExpr:
+		if e.Op != token.NOT {
+			return fmt.Errorf("unsupported operator %s", e.Op)
+		}
+		return checkExpression(e.X)
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.LAND, token.LOR, token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		default:
+			return fmt.Errorf("unsupported operator %s", e.Op)
+		}
+		if err := checkExpression(e.X); err != nil {
+			return err
+		}
+		return checkExpression(e.Y)
+	case *ast.CallExpr:
+		if _, err := propertyCallName(e); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported expression %T", expr)
+	}
+	return nil
+}
+
+// propertyCallName returns the property name of a property("name") call.
+func propertyCallName(call *ast.CallExpr) (string, error) {
+	if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "property" || len(call.Args) != 1 {
+		return "", fmt.Errorf(`only property("name") calls are supported`)
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", fmt.Errorf("property takes a string literal")
+	}
+	return strconv.Unquote(lit.Value)
+}
+
+// Match evaluates the expression for an image. Identifiers are the built-in
+// fields name, status, visibility, protected, size_bytes, age_hours and
+// age_days, or else image properties, and missing properties are nil.
+func (d *deleteExpression) Match(p *OpenStackPostProcessor, img images.Image, now time.Time) (bool, error) {
+	v, err := evalExpression(d.expr, p, img, now)
+	if err != nil {
+		return false, fmt.Errorf("delete_expression %q: %s", d.source, err)
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("delete_expression %q is not a boolean", d.source)
+	}
+	return b, nil
+}
+
+func evalExpression(expr ast.Expr, p *OpenStackPostProcessor, img images.Image, now time.Time) (interface{}, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			return strconv.Unquote(e.Value)
+		}
+		return strconv.ParseFloat(e.Value, 64)
+	case *ast.Ident:
+		return imageField(e.Name, p, img, now), nil
+	case *ast.ParenExpr:
+		return evalExpression(e.X, p, img, now)
+	case *ast.CallExpr:
+		name, err := propertyCallName(e)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := p.property(img, name); ok {
+			return v, nil
+		}
+		return nil, nil
+	case *ast.UnaryExpr:
+		x, err := evalBool(e.X, p, img, now)
+		return !x, err
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.LAND, token.LOR:
+			x, err := evalBool(e.X, p, img, now)
+			if err != nil || x == (e.Op == token.LOR) {
+				return x, err
+			}
+			return evalBool(e.Y, p, img, now)
+		}
+		x, err := evalExpression(e.X, p, img, now)
+		if err != nil {
+			return nil, err
+		}
+		y, err := evalExpression(e.Y, p, img, now)
+		if err != nil {
+			return nil, err
+		}
+		return compareExpression(e.Op, x, y)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+// imageField returns a built-in field of the image, or else its property.
+func imageField(name string, p *OpenStackPostProcessor, img images.Image, now time.Time) interface{} {
+	switch name {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "nil":
+		return nil
+	case "name":
+		return img.Name
+	case "status":
+		return string(img.Status)
+	case "visibility":
+		return string(img.Visibility)
+	case "protected":
+		return img.Protected
+	case "size_bytes":
+		return float64(img.SizeBytes)
+	case "age_hours":
+		return now.Sub(imageCreatedAt(img)).Hours()
+	case "age_days":
+		return now.Sub(imageCreatedAt(img)).Hours() / 24
+	}
+	if v, ok := p.property(img, name); ok {
+		return v
+	}
+	return nil
+}
+
+// compareExpression compares two values. Values compare as numbers when both
+// are numbers or numeric strings, and nil only equals nil.
+func compareExpression(op token.Token, x, y interface{}) (bool, error) {
+	if x == nil || y == nil {
+		switch op {
+		case token.EQL:
+			return x == y, nil
+		case token.NEQ:
+			return x != y, nil
+		}
+		return false, nil
+	}
+
+	if a, ok := x.(bool); ok {
+		b, ok := y.(bool)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %v with %v", x, y)
+		}
+		switch op {
+		case token.EQL:
+			return a == b, nil
+		case token.NEQ:
+			return a != b, nil
+		}
+		return false, fmt.Errorf("cannot order booleans")
+	}
+
+	var c int
+	a, aok := expressionNumber(x)
+	b, bok := expressionNumber(y)
+	if aok && bok {
+		switch {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+	} else {
+		a, aok := x.(string)
+		b, bok := y.(string)
+		if !aok || !bok {
+			return false, fmt.Errorf("cannot compare %v with %v", x, y)
+		}
+		switch {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+	}
+
+	switch op {
+	case token.EQL:
+		return c == 0, nil
+	case token.NEQ:
+		return c != 0, nil
+	case token.LSS:
+		return c < 0, nil
+	case token.LEQ:
+		return c <= 0, nil
+	case token.GTR:
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+// expressionNumber returns a number value, or a string property holding
+// one, as a float.
+func expressionNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// evalBool evaluates an operand of !, && or ||, which must be a boolean.
+// Missing properties are false.
+func evalBool(expr ast.Expr, p *OpenStackPostProcessor, img images.Image, now time.Time) (bool, error) {
+	v, err := evalExpression(expr, p, img, now)
+	if err != nil || v == nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%v is not a boolean", v)
+	}
+	return b, nil
+}
@@ -0,0 +1,126 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestDeleteExpressionMatch(t *testing.T) {
+	now := time.Date(2020, 8, 5, 12, 0, 0, 0, time.UTC)
+	img := images.Image{
+		Name:      "app",
+		Status:    images.ImageStatusActive,
+		SizeBytes: 2048,
+		CreatedAt: now.Add(-72 * time.Hour),
+		Properties: map[string]interface{}{
+			"channel":      "edge",
+			"build_result": "failure",
+			"build":        "10",
+			"os-version":   "20.04",
+		},
+	}
+
+	cases := map[string]bool{
+		`channel == "edge" && build_result == "failure"`:   true,
+		`channel == "stable" || build_result == "success"`: false,
+		`!(channel == "edge")`:                             false,
+		`age_days > 2 && age_hours < 73`:                   true,
+		`build > 9`:                                        true,
+		`build > "9"`:                                      true,
+		`property("os-version") == "20.04"`:                true,
+		`missing == nil && missing != "x"`:                 true,
+		`missing > 1`:                                      false,
+		`status == "active" && !protected`:                 true,
+		`size_bytes >= 2048 && name == "app"`:              true,
+	}
+	var p OpenStackPostProcessor
+	for source, expected := range cases {
+		d, err := parseDeleteExpression(source)
+		if err != nil {
+			t.Errorf("%s: %s", source, err)
+			continue
+		}
+		actual, err := d.Match(&p, img, now)
+		if err != nil {
+			t.Errorf("%s: %s", source, err)
+		} else if actual != expected {
+			t.Errorf("%s = %t, expected %t", source, actual, expected)
+		}
+	}
+
+	d, err := parseDeleteExpression(`channel && true`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := d.Match(&p, img, now); err == nil || !strings.Contains(err.Error(), "edge is not a boolean") {
+		t.Fatalf("should fail on a non boolean operand: %v", err)
+	}
+}
+
+func TestParseDeleteExpressionInvalid(t *testing.T) {
+	for _, source := range []string{
+		`channel ==`,
+		`os.Exit(1) == nil`,
+		`channel + "x" == "edgex"`,
+		`property(channel) == "x"`,
+		`func() bool { return true }()`,
+		`size_bytes > 0x10`,
+		`size_bytes > 0o17`,
+	} {
+		if _, err := parseDeleteExpression(source); err == nil {
+			t.Errorf("%s should be rejected", source)
+		}
+	}
+}
+
+func TestPostProcessorDeleteExpression(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 3
+	d, err := parseDeleteExpression(`name == "packer-example" && ramdisk_id == "8c64f48a-45a3-4eaa-adff-a8106b6c005b"`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	p.config.deletion = d
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "07aa21a9-fa1a-430e-9a33-185be5982431" {
+		t.Fatalf("images matching delete_expression should be deleted: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorConfigureDeleteExpression(t *testing.T) {
+	identity := testIdentityServer(t)
+	defer identity.Close()
+
+	raw := testConfig(identity)
+	raw["delete_expression"] = `channel = "edge"`
+
+	var p OpenStackPostProcessor
+	if err := p.Configure(raw); err == nil || !strings.Contains(err.Error(), "delete_expression") {
+		t.Fatalf("should reject an invalid expression: %v", err)
+	}
+
+	raw["delete_expression"] = `channel == "edge"`
+	p = OpenStackPostProcessor{}
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.config.deletion == nil {
+		t.Fatal("expression should be parsed")
+	}
+}
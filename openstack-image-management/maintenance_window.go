@@ -0,0 +1,102 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// maintenanceWindow is a daily time range, optionally restricted to some
+// days of the week. Times are evaluated in UTC. A range whose end is before
+// its start runs past midnight, and belongs to the day it starts on.
+type maintenanceWindow struct {
+	days  [7]bool
+	start int
+	end   int
+}
+
+// parseMaintenanceWindow parses a window such as "22:00-04:00" or
+// "Mon-Fri,Sun 01:00-05:00".
+func parseMaintenanceWindow(s string) (*maintenanceWindow, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid maintenance window %q: expected \"[days] HH:MM-HH:MM\"", s)
+	}
+
+	w := &maintenanceWindow{}
+	if len(fields) == 1 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	} else {
+		for _, part := range strings.Split(fields[0], ",") {
+			bounds := strings.SplitN(part, "-", 2)
+			first, ok := weekdays[strings.ToLower(bounds[0])]
+			if !ok {
+				return nil, fmt.Errorf("invalid maintenance window %q: unknown day %q", s, bounds[0])
+			}
+			last := first
+			if len(bounds) == 2 {
+				if last, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+					return nil, fmt.Errorf("invalid maintenance window %q: unknown day %q", s, bounds[1])
+				}
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				w.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	}
+
+	times := strings.SplitN(fields[len(fields)-1], "-", 2)
+	if len(times) != 2 {
+		return nil, fmt.Errorf("invalid maintenance window %q: expected a time range HH:MM-HH:MM", s)
+	}
+	var err error
+	if w.start, err = parseClock(times[0]); err != nil {
+		return nil, fmt.Errorf("invalid maintenance window %q: %s", s, err)
+	}
+	if w.end, err = parseClock(times[1]); err != nil {
+		return nil, fmt.Errorf("invalid maintenance window %q: %s", s, err)
+	}
+
+	return w, nil
+}
+
+// parseClock returns the minutes since midnight of a HH:MM time.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t falls inside the window.
+func (w *maintenanceWindow) Contains(t time.Time) bool {
+	t = t.UTC()
+	m := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if w.start < w.end {
+		return w.days[day] && m >= w.start && m < w.end
+	}
+
+	// The window runs past midnight.
+	if m >= w.start {
+		return w.days[day]
+	}
+	return m < w.end && w.days[(day+6)%7]
+}
@@ -0,0 +1,47 @@
+package openstackimagemanagement
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	cases := []struct {
+		window   string
+		time     string
+		expected bool
+	}{
+		{"01:00-05:00", "2020-08-03T00:59:00Z", false},
+		{"01:00-05:00", "2020-08-03T01:00:00Z", true},
+		{"01:00-05:00", "2020-08-03T05:00:00Z", false},
+		{"Mon-Fri 01:00-05:00", "2020-08-03T02:00:00Z", true},  // Monday
+		{"Mon-Fri 01:00-05:00", "2020-08-02T02:00:00Z", false}, // Sunday
+		{"Sat,Sun 01:00-05:00", "2020-08-02T02:00:00Z", true},
+		{"Fri-Mon 01:00-05:00", "2020-08-04T02:00:00Z", false}, // Tuesday
+		{"Fri 22:00-02:00", "2020-08-07T23:00:00Z", true},      // Friday
+		{"Fri 22:00-02:00", "2020-08-08T01:00:00Z", true},      // Saturday morning
+		{"Fri 22:00-02:00", "2020-08-08T23:00:00Z", false},     // Saturday night
+	}
+
+	for _, c := range cases {
+		w, err := parseMaintenanceWindow(c.window)
+		if err != nil {
+			t.Fatalf("%s: err: %s", c.window, err)
+		}
+		now, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual := w.Contains(now); actual != c.expected {
+			t.Errorf("%s contains %s: expected %t, got %t", c.window, c.time, c.expected, actual)
+		}
+	}
+}
+
+func TestParseMaintenanceWindowInvalid(t *testing.T) {
+	for _, s := range []string{"", "01:00", "Funday 01:00-02:00", "01:00-25:00", "Mon 01:00-02:00 UTC"} {
+		if _, err := parseMaintenanceWindow(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
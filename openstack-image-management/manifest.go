@@ -0,0 +1,52 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+// manifestImageIDs returns the image IDs referenced by the properties of the
+// images named manifest_image_name, and the IDs of those images. Property
+// values may hold several IDs separated by commas or spaces.
+func (p *OpenStackPostProcessor) manifestImageIDs() (map[string]bool, error) {
+	var manifests []images.Image
+	err := p.withReauth(func() error {
+		manifests = nil
+		return images.List(p.conn, images.ListOpts{Name: p.config.ManifestImageName}).EachPage(func(page pagination.Page) (bool, error) {
+			imgs, err := images.ExtractImages(page)
+			if err != nil {
+				return false, err
+			}
+			manifests = append(manifests, imgs...)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list manifest image %q: %s", p.config.ManifestImageName, err)
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("manifest image %q not found", p.config.ManifestImageName)
+	}
+
+	ids := make(map[string]bool)
+	for _, manifest := range manifests {
+		ids[manifest.ID] = true
+		for name := range manifest.Properties {
+			v, _ := imageProperty(manifest, name)
+			for _, id := range strings.FieldsFunc(v, isManifestSeparator) {
+				ids[id] = true
+			}
+		}
+	}
+	return ids, nil
+}
+
+// isManifestSeparator reports whether a rune separates the IDs of a manifest
+// property value, including the brackets and quotes of JSON lists.
+func isManifestSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`,;[]"`, r)
+}
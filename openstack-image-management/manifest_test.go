@@ -0,0 +1,37 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessorManifestImageName(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	manifest := imgs[3]
+	manifest.JSON = strings.Replace(manifest.JSON, `"name": "cirros-0.3.4-x86_64-uec-kernel"`, `"name": "release-manifest", "published": "[\"8c64f48a-45a3-4eaa-adff-a8106b6c005b\", \"other\"]"`, 1)
+	calls := ImageListHandler(t, []imageEntry{imgs[0], imgs[1], imgs[2], manifest})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.ManifestImageName = "release-manifest"
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("image referenced by the manifest should be kept: %v", calls.Deleted)
+	}
+
+	p.config.ManifestImageName = "missing-manifest"
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err == nil || !strings.Contains(err.Error(), `manifest image "missing-manifest" not found`) {
+		t.Fatalf("should fail without the manifest image: %v", err)
+	}
+}
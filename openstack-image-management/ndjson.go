@@ -0,0 +1,86 @@
+package openstackimagemanagement
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+const (
+	actionKeep   = "keep"
+	actionDelete = "delete"
+	actionSkip   = "skip"
+)
+
+type imageAction struct {
+	Action    string `json:"action"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	Age       string `json:"age,omitempty"`
+}
+
+// actionEmitter records every image action for the report and, when out is
+// set, writes it there as one compact JSON object per line. The UI prefixes
+// every line it shows, so the actions are kept apart from the human readable
+// messages.
+type actionEmitter struct {
+	out     io.Writer
+	actions []imageAction
+}
+
+func (e *actionEmitter) Emit(action string, img images.Image, reason string) {
+	a := imageAction{
+		Action: action,
+		ID:     img.ID,
+		Name:   img.Name,
+		Reason: reason,
+		Size:   img.SizeBytes,
+		Age:    imageAge(img, time.Now()),
+	}
+	if created := imageCreatedAt(img); !created.IsZero() {
+		a.CreatedAt = created.UTC().Format(time.RFC3339)
+	}
+	e.actions = append(e.actions, a)
+
+	if e.out == nil {
+		return
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		log.Printf("Failed to encode image action: %s", err)
+		return
+	}
+	if _, err := fmt.Fprintf(e.out, "%s\n", b); err != nil {
+		log.Printf("Failed to write image action: %s", err)
+	}
+}
+
+// Count returns the number of recorded actions of the given kind.
+func (e *actionEmitter) Count(action string) int {
+	n := 0
+	for _, a := range e.actions {
+		if a.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// DeletedBytes returns the total size of the deleted images.
+func (e *actionEmitter) DeletedBytes() int64 {
+	var n int64
+	for _, a := range e.actions {
+		if a.Action == actionDelete {
+			n += a.Size
+		}
+	}
+	return n
+}
@@ -0,0 +1,111 @@
+package openstackimagemanagement
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/streadway/amqp"
+)
+
+const (
+	defaultNotifyExchange   = "glance"
+	defaultNotifyRoutingKey = "notifications.info"
+
+	notifyEventImageDelete = "image_management.image.delete"
+)
+
+// amqpNotifier publishes retention events as oslo.messaging notifications,
+// so that consumers of the Glance notifications receive them as well.
+type amqpNotifier struct {
+	conn       *amqp.Connection
+	channel    *amqp.Channel
+	exchange   string
+	routingKey string
+	publisher  string
+}
+
+type notificationPayload struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Identifier string `json:"identifier"`
+	Size       int64  `json:"size,omitempty"`
+	CreatedAt  string `json:"created_at,omitempty"`
+}
+
+func newAMQPNotifier(url, exchange, routingKey string) (*amqpNotifier, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	return &amqpNotifier{
+		conn:       conn,
+		channel:    channel,
+		exchange:   exchange,
+		routingKey: routingKey,
+		publisher:  "image-management." + host,
+	}, nil
+}
+
+// NotifyDeleted publishes the deletion of an image.
+func (n *amqpNotifier) NotifyDeleted(img images.Image, identifier string) error {
+	payload := notificationPayload{
+		ID:         img.ID,
+		Name:       img.Name,
+		Identifier: identifier,
+		Size:       img.SizeBytes,
+	}
+	if created := imageCreatedAt(img); !created.IsZero() {
+		payload.CreatedAt = created.UTC().Format(time.RFC3339)
+	}
+
+	body, err := notificationMessage(n.publisher, notifyEventImageDelete, payload, time.Now())
+	if err != nil {
+		return err
+	}
+	return n.channel.Publish(n.exchange, n.routingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+}
+
+func (n *amqpNotifier) Close() {
+	n.channel.Close()
+	n.conn.Close()
+}
+
+// notificationMessage builds an oslo.messaging 2.0 notification envelope.
+func notificationMessage(publisher, eventType string, payload interface{}, now time.Time) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	message, err := json.Marshal(map[string]interface{}{
+		"message_id":   fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]),
+		"publisher_id": publisher,
+		"event_type":   eventType,
+		"priority":     "INFO",
+		"payload":      payload,
+		"timestamp":    now.UTC().Format("2006-01-02 15:04:05.000000"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]string{
+		"oslo.version": "2.0",
+		"oslo.message": string(message),
+	})
+}
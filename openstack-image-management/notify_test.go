@@ -0,0 +1,49 @@
+package openstackimagemanagement
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNotificationMessage(t *testing.T) {
+	now := time.Date(2020, 8, 5, 12, 30, 0, 0, time.UTC)
+	payload := notificationPayload{ID: "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4", Name: "packer-example", Identifier: "packer-example"}
+	b, err := notificationMessage("image-management.host", notifyEventImageDelete, payload, now)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var envelope map[string]string
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if envelope["oslo.version"] != "2.0" {
+		t.Fatalf("unexpected version: %s", envelope["oslo.version"])
+	}
+
+	var message struct {
+		MessageID   string              `json:"message_id"`
+		PublisherID string              `json:"publisher_id"`
+		EventType   string              `json:"event_type"`
+		Priority    string              `json:"priority"`
+		Payload     notificationPayload `json:"payload"`
+		Timestamp   string              `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(envelope["oslo.message"]), &message); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(message.MessageID) != 36 {
+		t.Fatalf("unexpected message id: %s", message.MessageID)
+	}
+	if message.PublisherID != "image-management.host" || message.EventType != "image_management.image.delete" || message.Priority != "INFO" {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+	if message.Payload != payload {
+		t.Fatalf("unexpected payload: %+v", message.Payload)
+	}
+	if message.Timestamp != "2020-08-05 12:30:00.000000" {
+		t.Fatalf("unexpected timestamp: %s", message.Timestamp)
+	}
+}
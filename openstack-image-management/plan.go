@@ -0,0 +1,81 @@
+package openstackimagemanagement
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// deletionPlan is the list of images a planning run would delete, written to
+// the plan_file for approval.
+type deletionPlan struct {
+	Identifiers []string       `json:"identifiers"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Images      []plannedImage `json:"images"`
+}
+
+type plannedImage struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Checksum  string    `json:"checksum,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newDeletionPlan(identifiers []string, imgs []images.Image, now time.Time) *deletionPlan {
+	plan := &deletionPlan{Identifiers: identifiers, CreatedAt: now.UTC(), Images: []plannedImage{}}
+	for _, img := range imgs {
+		plan.Images = append(plan.Images, plannedImage{
+			ID:        img.ID,
+			Name:      img.Name,
+			Checksum:  img.Checksum,
+			UpdatedAt: img.UpdatedAt,
+		})
+	}
+	return plan
+}
+
+func writeDeletionPlan(path string, plan *deletionPlan) error {
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+func readDeletionPlan(path string) (*deletionPlan, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan deletionPlan
+	if err := json.Unmarshal(b, &plan); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %s", path, err)
+	}
+	return &plan, nil
+}
+
+// Match returns the images of the plan out of the images the current run
+// would delete, in the plan order. It fails if a planned image is no longer
+// to be deleted or was changed since planning.
+func (plan *deletionPlan) Match(expired []images.Image) ([]images.Image, error) {
+	current := make(map[string]images.Image)
+	for _, img := range expired {
+		current[img.ID] = img
+	}
+
+	var matched []images.Image
+	for _, planned := range plan.Images {
+		img, ok := current[planned.ID]
+		if !ok {
+			return nil, fmt.Errorf("image %s is no longer to be deleted", planned.ID)
+		}
+		if img.Checksum != planned.Checksum || !img.UpdatedAt.Equal(planned.UpdatedAt) {
+			return nil, fmt.Errorf("image %s was changed since planning", planned.ID)
+		}
+		matched = append(matched, img)
+	}
+	return matched, nil
+}
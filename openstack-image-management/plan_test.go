@@ -0,0 +1,110 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessorPlanApproveApply(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 2
+	p.config.PlanFile = filepath.Join(dir, "plan.json")
+	p.config.ApprovalFile = filepath.Join(dir, "approved")
+
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(calls.Updated) != 0 || len(calls.Deleted) != 0 {
+		t.Fatalf("planning should not act: %v %v", calls.Updated, calls.Deleted)
+	}
+	plan, err := readDeletionPlan(p.config.PlanFile)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(plan.Images) != 1 || plan.Images[0].ID != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("unexpected plan: %+v", plan.Images)
+	}
+
+	_, _, _, err = p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{})
+	if err == nil || !strings.Contains(err.Error(), "is waiting for approval") {
+		t.Fatalf("should wait for approval: %v", err)
+	}
+
+	if err := ioutil.WriteFile(p.config.ApprovalFile, nil, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+	}
+	for _, path := range []string{p.config.PlanFile, p.config.ApprovalFile} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed once applied", path)
+		}
+	}
+}
+
+func TestPostProcessorConfigurePlanFileRegions(t *testing.T) {
+	identity := testIdentityServer(t)
+	defer identity.Close()
+
+	raw := testConfig(identity)
+	raw["plan_file"] = "plan.json"
+	raw["approval_file"] = "approved"
+	raw["regions"] = []string{"RegionOne", "RegionTwo"}
+
+	var p OpenStackPostProcessor
+	if err := p.Configure(raw); err == nil || !strings.Contains(err.Error(), "plan_file cannot be combined with regions") {
+		t.Fatalf("should reject plan_file with regions: %v", err)
+	}
+}
+
+func TestDeletionPlanMatch(t *testing.T) {
+	updated := time.Date(2020, 8, 5, 12, 0, 0, 0, time.UTC)
+	expired := []images.Image{
+		{ID: "a", Checksum: "1", UpdatedAt: updated},
+		{ID: "b", Checksum: "2", UpdatedAt: updated},
+	}
+	plan := newDeletionPlan([]string{"packer-example"}, expired[1:], updated)
+
+	matched, err := plan.Match(expired)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ids := imageIDs(matched); strings.Join(ids, ",") != "b" {
+		t.Fatalf("unexpected matched images: %v", ids)
+	}
+
+	expired[1].UpdatedAt = updated.Add(time.Minute)
+	if _, err := plan.Match(expired); err == nil || !strings.Contains(err.Error(), "image b was changed since planning") {
+		t.Fatalf("should detect the change: %v", err)
+	}
+
+	if _, err := plan.Match(expired[:1]); err == nil || !strings.Contains(err.Error(), "image b is no longer to be deleted") {
+		t.Fatalf("should detect the drift: %v", err)
+	}
+}
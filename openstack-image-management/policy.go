@@ -0,0 +1,63 @@
+package openstackimagemanagement
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// policyKeys are the configuration keys that may be set from the retention
+// policy given by policy_json_env.
+var policyKeys = map[string]bool{
+	"dedupe_same_name":            true,
+	"global_max_keep":             true,
+	"group_by_property":           true,
+	"keep_by_score":               true,
+	"keep_failed_releases":        true,
+	"keep_releases":               true,
+	"keep_releases_by_identifier": true,
+	"keep_until_superseded":       true,
+	"keep_weekly":                 true,
+	"manage_snapshots":            true,
+	"match_properties":            true,
+	"max_deletes_per_run":         true,
+	"name_pattern":                true,
+	"prefer_distinct_checksums":   true,
+	"rules":                       true,
+	"score_property_weights":      true,
+	"score_recency_weight":        true,
+	"score_size_weight":           true,
+	"snapshot_group_property":     true,
+	"sort_by":                     true,
+	"success_property":            true,
+	"success_value":               true,
+}
+
+// policyFromEnv reads the JSON retention policy from the named environment
+// variable. Only retention related keys are accepted, so that authentication
+// stays in the template.
+func policyFromEnv(name string) (map[string]interface{}, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("policy_json_env: environment variable %s is not set", name)
+	}
+
+	var policy map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return nil, fmt.Errorf("policy_json_env: invalid JSON in %s: %s", name, err)
+	}
+
+	var unknown []string
+	for key := range policy {
+		if !policyKeys[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("policy_json_env: %s contains keys that are not retention settings: %v", name, unknown)
+	}
+
+	return policy, nil
+}
@@ -1,4 +1,4 @@
-//go:generate mapstructure-to-hcl2 -type Config
+//go:generate mapstructure-to-hcl2 -type Config,RetentionRule
 
 package openstackimagemanagement
 
@@ -7,9 +7,17 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/gophercloud/gophercloud"
 	gopenstack "github.com/gophercloud/gophercloud/openstack"
@@ -31,93 +39,1743 @@ type Config struct {
 	Identifier   string `mapstructure:"identifier"`
 	KeepReleases int    `mapstructure:"keep_releases"`
 
-	ctx interpolate.Context
+	Identifiers              []string       `mapstructure:"identifiers"`
+	KeepReleasesByIdentifier map[string]int `mapstructure:"keep_releases_by_identifier"`
+	Prefixes                 []string       `mapstructure:"prefixes"`
+	MultiMatchPolicy         string         `mapstructure:"multi_match_policy"`
+
+	PreferDistinctChecksums bool `mapstructure:"prefer_distinct_checksums"`
+
+	TerraformOutput string `mapstructure:"terraform_output"`
+
+	MaintenanceWindow string `mapstructure:"maintenance_window"`
+
+	MetadataTargetIDs []string `mapstructure:"metadata_target_ids"`
+
+	MaxDeletesPerRun int `mapstructure:"max_deletes_per_run"`
+
+	CheckQuota string `mapstructure:"check_quota"`
+
+	MaxPages int `mapstructure:"max_pages"`
+
+	ImageEndpoints []string `mapstructure:"image_endpoints"`
+
+	NDJSONOutput     bool   `mapstructure:"ndjson_output"`
+	NDJSONOutputFile string `mapstructure:"ndjson_output_file"`
+
+	KeepWeekly int `mapstructure:"keep_weekly"`
+
+	KeepUntilSuperseded int `mapstructure:"keep_until_superseded"`
+
+	PolicyJSONEnv string `mapstructure:"policy_json_env"`
+
+	SkipIfPropertyEquals map[string]string `mapstructure:"skip_if_property_equals"`
+
+	ManageOnlyTeams []string `mapstructure:"manage_only_teams"`
+
+	CountOwnedOnly bool `mapstructure:"count_owned_only"`
+
+	ExcludeIfPropertyTruthy []string `mapstructure:"exclude_if_property_truthy"`
+
+	CIOutputFormat string `mapstructure:"ci_output_format"`
+	CIOutputFile   string `mapstructure:"ci_output_file"`
+
+	ReportOutput            string   `mapstructure:"report_output"`
+	PostRunCommand          []string `mapstructure:"post_run_command"`
+	PostRunCommandOnFailure string   `mapstructure:"post_run_command_on_failure"`
+
+	WarnOnEmptyList       config.Trilean `mapstructure:"warn_on_empty_list"`
+	EmptyListVisibleCheck bool           `mapstructure:"empty_list_visible_check"`
+
+	BaseImageProperty     string `mapstructure:"base_image_property"`
+	RequiresImageProperty string `mapstructure:"requires_image_property"`
+
+	StatsdAddress string `mapstructure:"statsd_address"`
+	StatsdPrefix  string `mapstructure:"statsd_prefix"`
+
+	NotifyAMQPURL        string `mapstructure:"notify_amqp_url"`
+	NotifyAMQPExchange   string `mapstructure:"notify_amqp_exchange"`
+	NotifyAMQPRoutingKey string `mapstructure:"notify_amqp_routing_key"`
+
+	ManualDeleteProperty string `mapstructure:"manual_delete_property"`
+
+	RemoveProperties []string      `mapstructure:"remove_properties"`
+	UpdateMetaWithin time.Duration `mapstructure:"update_meta_within"`
+	StripProperties  []string      `mapstructure:"strip_properties"`
+
+	RequiredProperties []string `mapstructure:"required_properties"`
+
+	FailOnSkips bool `mapstructure:"fail_on_skips"`
+
+	ManageSnapshots       bool   `mapstructure:"manage_snapshots"`
+	SnapshotGroupProperty string `mapstructure:"snapshot_group_property"`
+
+	DedupeSameName bool `mapstructure:"dedupe_same_name"`
+
+	SuccessProperty    string `mapstructure:"success_property"`
+	SuccessValue       string `mapstructure:"success_value"`
+	KeepFailedReleases int    `mapstructure:"keep_failed_releases"`
+
+	NamePattern     string            `mapstructure:"name_pattern"`
+	MatchProperties map[string]string `mapstructure:"match_properties"`
+	SortBy          string            `mapstructure:"sort_by"`
+
+	KeepByScore          bool               `mapstructure:"keep_by_score"`
+	ScoreRecencyWeight   float64            `mapstructure:"score_recency_weight"`
+	ScoreSizeWeight      float64            `mapstructure:"score_size_weight"`
+	ScorePropertyWeights map[string]float64 `mapstructure:"score_property_weights"`
+
+	Rules []RetentionRule `mapstructure:"rules"`
+
+	DeleteExpression string `mapstructure:"delete_expression"`
+
+	GroupByProperty string `mapstructure:"group_by_property"`
+	GlobalMaxKeep   int    `mapstructure:"global_max_keep"`
+
+	CheckOnly bool `mapstructure:"check_only"`
+
+	VerifySignature bool `mapstructure:"verify_signature"`
+
+	Regions        []string `mapstructure:"regions"`
+	AllowedRegions []string `mapstructure:"allowed_regions"`
+
+	ProtectedIDs []string `mapstructure:"protected_ids"`
+
+	SweepOrphans          bool          `mapstructure:"sweep_orphans"`
+	SweepOrphansOlderThan time.Duration `mapstructure:"sweep_orphans_older_than"`
+	Force                 bool          `mapstructure:"force"`
+
+	PlanFile     string `mapstructure:"plan_file"`
+	ApprovalFile string `mapstructure:"approval_file"`
+
+	DeleteScriptOutput string `mapstructure:"delete_script_output"`
+
+	ProtectIfUpdatedWithin time.Duration `mapstructure:"protect_if_updated_within"`
+
+	AnchorNowToNewest bool `mapstructure:"anchor_now_to_newest"`
+
+	ManifestImageName string `mapstructure:"manifest_image_name"`
+
+	CheckpointFile string `mapstructure:"checkpoint_file"`
+
+	RecoveryManifest string `mapstructure:"recovery_manifest"`
+
+	ManageCurrentOnly bool   `mapstructure:"manage_current_only"`
+	CurrentTag        string `mapstructure:"current_tag"`
+	CurrentProperty   string `mapstructure:"current_property"`
+	CurrentValue      string `mapstructure:"current_value"`
+
+	ArchiveToSwift   string `mapstructure:"archive_to_swift"`
+	ArchivePrefix    string `mapstructure:"archive_prefix"`
+	ArchiveOnFailure string `mapstructure:"archive_on_failure"`
+
+	ReauthToken                       string `mapstructure:"reauth_token"`
+	ReauthApplicationCredentialID     string `mapstructure:"reauth_application_credential_id"`
+	ReauthApplicationCredentialSecret string `mapstructure:"reauth_application_credential_secret"`
+
+	ctx         interpolate.Context
+	window      *maintenanceWindow
+	namePattern *regexp.Regexp
+	deletion    *deleteExpression
+}
+
+type OpenStackPostProcessor struct {
+	config        Config
+	conn          *gophercloud.ServiceClient
+	keyManager    *gophercloud.ServiceClient
+	objectStorage *gophercloud.ServiceClient
+
+	// project is the ID of the project of the token, set for count_owned_only.
+	project string
+	// manifestIDs are the IDs protected by manifest_image_name.
+	manifestIDs map[string]bool
+	// recovery are the images of the recovery_manifest, across regions.
+	recovery []recoveryImage
+	// ndjson is where ndjson_output writes the actions, across regions.
+	ndjson io.Writer
+}
+
+func (p *OpenStackPostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+func (p *OpenStackPostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.PolicyJSONEnv != "" {
+		policy, err := policyFromEnv(p.config.PolicyJSONEnv)
+		if err != nil {
+			return err
+		}
+
+		// Decode again with the policy first, so the template values win.
+		p.config = Config{}
+		err = config.Decode(&p.config, &config.DecodeOpts{
+			Interpolate:        true,
+			InterpolateContext: &p.config.ctx,
+		}, append([]interface{}{policy}, raws...)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	var errs *packer.MultiError
+	errs = packer.MultiErrorAppend(errs, p.config.AccessConfig.Prepare(&p.config.ctx)...)
+
+	if p.config.KeepWeekly < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("keep_weekly must not be negative"))
+	}
+
+	if p.config.KeepUntilSuperseded < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("keep_until_superseded must not be negative"))
+	}
+
+	if len(p.config.KeepReleasesByIdentifier) > 0 {
+		configured := make(map[string]bool)
+		for _, identifier := range p.families() {
+			configured[identifier] = true
+			if _, ok := p.config.KeepReleasesByIdentifier[identifier]; !ok && p.config.KeepReleases <= 0 {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("identifier %s has no keep_releases_by_identifier entry and keep_releases is not set", identifier))
+			}
+		}
+		for identifier, keep := range p.config.KeepReleasesByIdentifier {
+			if !configured[identifier] {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("keep_releases_by_identifier: %s is not a configured identifier or prefix", identifier))
+			}
+			if keep < 0 {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("keep_releases_by_identifier: %s must not be negative", identifier))
+			}
+		}
+	}
+
+	for _, prefix := range p.config.Prefixes {
+		if prefix == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("prefixes must not contain an empty prefix"))
+		}
+	}
+
+	if p.config.MaxPages < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("max_pages must not be negative"))
+	}
+
+	for i, rule := range p.config.Rules {
+		if rule.Property == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("rules[%d]: property must be set", i))
+		}
+		if rule.KeepReleases < 0 || rule.MaxAge < 0 {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("rules[%d]: keep_releases and max_age must not be negative", i))
+		}
+	}
+	if len(p.config.Rules) > 0 {
+		// Images matching a rule only keep its settings, so these would be
+		// silently ignored for them.
+		for _, mode := range []struct {
+			key string
+			set bool
+		}{
+			{"manual_delete_property", p.config.ManualDeleteProperty != ""},
+			{"dedupe_same_name", p.config.DedupeSameName},
+			{"group_by_property", p.config.GroupByProperty != ""},
+			{"keep_weekly", p.config.KeepWeekly > 0},
+			{"keep_by_score", p.config.KeepByScore},
+			{"success_property", p.config.SuccessProperty != ""},
+			{"keep_until_superseded", p.config.KeepUntilSuperseded > 0},
+		} {
+			if mode.set {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("rules cannot be combined with %s", mode.key))
+			}
+		}
+	}
+
+	if p.config.KeepFailedReleases < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("keep_failed_releases must not be negative"))
+	}
+	if p.config.SuccessValue == "" {
+		p.config.SuccessValue = "success"
+	}
+
+	if p.config.KeepByScore && p.config.ScoreRecencyWeight == 0 && p.config.ScoreSizeWeight == 0 && len(p.config.ScorePropertyWeights) == 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("keep_by_score requires a score_recency_weight, score_size_weight or score_property_weights"))
+	}
+
+	if p.config.GlobalMaxKeep < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("global_max_keep must not be negative"))
+	}
+	if p.config.GlobalMaxKeep > 0 && p.config.GroupByProperty == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("global_max_keep requires group_by_property"))
+	}
+
+	if p.config.MaxDeletesPerRun < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("max_deletes_per_run must not be negative"))
+	}
+
+	if p.config.RemoveProperties == nil {
+		p.config.RemoveProperties = defaultRemoveProperties
+	}
+	for _, name := range p.config.RemoveProperties {
+		if reservedProperties[name] {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("remove_properties: %s is a reserved image attribute and cannot be removed", name))
+		}
+	}
+	for _, name := range p.config.StripProperties {
+		if reservedProperties[name] {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("strip_properties: %s is a reserved image attribute and cannot be removed", name))
+		}
+	}
+
+	if (p.config.ReauthApplicationCredentialID == "") != (p.config.ReauthApplicationCredentialSecret == "") {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("reauth_application_credential_id and reauth_application_credential_secret must be set together"))
+	}
+	if p.config.ReauthToken != "" && p.config.ReauthApplicationCredentialID != "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("only one of reauth_token and reauth_application_credential_id can be set"))
+	}
+
+	if p.config.SnapshotGroupProperty == "" {
+		p.config.SnapshotGroupProperty = "instance_uuid"
+	}
+
+	if p.config.RequiresImageProperty == "" {
+		p.config.RequiresImageProperty = "requires_image_id"
+	}
+
+	if p.config.NotifyAMQPExchange == "" {
+		p.config.NotifyAMQPExchange = defaultNotifyExchange
+	}
+	if p.config.NotifyAMQPRoutingKey == "" {
+		p.config.NotifyAMQPRoutingKey = defaultNotifyRoutingKey
+	}
+
+	if p.config.BaseImageProperty == "" {
+		p.config.BaseImageProperty = "base_image_id"
+	}
+
+	switch p.config.CheckQuota {
+	case "", onFailureError, onFailureWarn:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("check_quota must be one of %q or %q", onFailureError, onFailureWarn))
+	}
+
+	switch p.config.PostRunCommandOnFailure {
+	case "":
+		p.config.PostRunCommandOnFailure = onFailureError
+	case onFailureError, onFailureWarn:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("post_run_command_on_failure must be one of %q or %q", onFailureError, onFailureWarn))
+	}
+
+	if len(p.config.Regions) > 0 && len(p.config.ImageEndpoints) > 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("image_endpoints cannot be combined with regions"))
+	}
+	if len(p.config.Regions) > 0 && p.config.CIOutputFormat != "" && p.config.CIOutputFile == "" {
+		// Each region would set the same GITHUB_OUTPUT step outputs.
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("ci_output_format with regions requires ci_output_file"))
+	}
+	if len(p.config.AllowedRegions) > 0 {
+		allowed := make(map[string]bool)
+		for _, region := range p.config.AllowedRegions {
+			allowed[region] = true
+		}
+		regions := p.config.Regions
+		if p.config.Region != "" {
+			regions = append([]string{p.config.Region}, regions...)
+		}
+		for _, region := range regions {
+			if !allowed[region] {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("region %s is not in allowed_regions", region))
+			}
+		}
+	}
+
+	if p.config.SweepOrphans {
+		if p.config.SweepOrphansOlderThan <= 0 {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("sweep_orphans requires a positive sweep_orphans_older_than"))
+		}
+		if p.config.PlanFile != "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("sweep_orphans cannot be combined with plan_file"))
+		}
+	}
+
+	if (p.config.PlanFile == "") != (p.config.ApprovalFile == "") {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("plan_file and approval_file must be set together"))
+	}
+	if p.config.PlanFile != "" && len(p.config.Regions) > 0 {
+		// The regions run separately, and would share a single plan.
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("plan_file cannot be combined with regions"))
+	}
+	if p.config.DeleteScriptOutput != "" && (p.config.PlanFile != "" || p.config.SweepOrphans) {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("delete_script_output cannot be combined with plan_file or sweep_orphans"))
+	}
+
+	if p.config.NDJSONOutput != (p.config.NDJSONOutputFile != "") {
+		// The standard output of a plugin is not shown by Packer.
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("ndjson_output and ndjson_output_file must be set together"))
+	}
+
+	if p.config.ManageCurrentOnly && p.config.CurrentTag == "" && p.config.CurrentProperty == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("manage_current_only requires current_tag or current_property"))
+	}
+	if reservedProperties[p.config.CurrentProperty] {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("current_property: %s is a reserved image attribute", p.config.CurrentProperty))
+	}
+	if p.config.CurrentValue == "" {
+		p.config.CurrentValue = "true"
+	}
+
+	switch p.config.MultiMatchPolicy {
+	case "":
+		p.config.MultiMatchPolicy = multiMatchFirst
+	case multiMatchFirst, multiMatchAll, multiMatchError:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("multi_match_policy must be one of %q, %q or %q", multiMatchFirst, multiMatchAll, multiMatchError))
+	}
+
+	switch p.config.CIOutputFormat {
+	case "", ciOutputGitHub:
+	case ciOutputGitLab:
+		if p.config.CIOutputFile == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("ci_output_format %s requires ci_output_file", ciOutputGitLab))
+		}
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("ci_output_format must be one of %q or %q", ciOutputGitHub, ciOutputGitLab))
+	}
+
+	switch p.config.ArchiveOnFailure {
+	case "":
+		p.config.ArchiveOnFailure = archiveFailureSkip
+	case archiveFailureSkip, archiveFailureDelete:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("archive_on_failure must be one of %q or %q", archiveFailureSkip, archiveFailureDelete))
+	}
+
+	if p.config.MaintenanceWindow != "" {
+		if p.config.window, err = parseMaintenanceWindow(p.config.MaintenanceWindow); err != nil {
+			errs = packer.MultiErrorAppend(errs, err)
+		}
+	}
+
+	if p.config.NamePattern != "" {
+		if p.config.namePattern, err = parseNamePattern(p.config.NamePattern); err != nil {
+			errs = packer.MultiErrorAppend(errs, err)
+		}
+	}
+	if p.config.DeleteExpression != "" {
+		if p.config.deletion, err = parseDeleteExpression(p.config.DeleteExpression); err != nil {
+			errs = packer.MultiErrorAppend(errs, err)
+		}
+	}
+	if p.config.SortBy != "" && p.config.SortBy != sortByCreatedAt &&
+		(!strings.HasPrefix(p.config.SortBy, sortByPropertyPrefix) || p.config.SortBy == sortByPropertyPrefix) {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("sort_by must be %q or %q followed by a property name", sortByCreatedAt, sortByPropertyPrefix))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	log.Println(p.config)
+	return nil
+}
+
+func (p *OpenStackPostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	log.Println("Running OpenStack Image Management Post-Processor")
+	p.recovery = nil
+	if p.config.RecoveryManifest != "" {
+		recovery, err := readRecoveryManifest(p.config.RecoveryManifest)
+		if err != nil {
+			return nil, true, false, err
+		}
+		p.recovery = recovery
+	}
+
+	if p.config.NDJSONOutput {
+		f, err := os.Create(p.config.NDJSONOutputFile)
+		if err != nil {
+			return nil, true, false, fmt.Errorf("failed to create %s: %s", p.config.NDJSONOutputFile, err)
+		}
+		defer f.Close()
+		p.ndjson = f
+	}
+
+	if len(p.config.Regions) == 0 {
+		return p.postProcess(ctx, ui, artifact)
+	}
+
+	// Each region is a separate run, with its own connection and outputs.
+	defer func(c Config) { p.config = c }(p.config)
+	base := p.config
+	for _, region := range p.config.Regions {
+		ui.Say(fmt.Sprintf("Managing images in region %s", region))
+		p.config.Region = region
+		p.config.ReportOutput = regionPath(base.ReportOutput, region)
+		p.config.TerraformOutput = regionPath(base.TerraformOutput, region)
+		p.config.DeleteScriptOutput = regionPath(base.DeleteScriptOutput, region)
+		p.config.CIOutputFile = regionPath(base.CIOutputFile, region)
+		p.conn, p.keyManager, p.objectStorage = nil, nil, nil
+		if _, _, _, err := p.postProcess(ctx, ui, artifact); err != nil {
+			return nil, true, false, fmt.Errorf("region %s: %s", region, err)
+		}
+	}
+	return artifact, true, false, nil
+}
+
+// multiPartExtensions are the extensions of output paths that other tools
+// recognize as a whole.
+var multiPartExtensions = []string{".tf.json"}
+
+// regionPath inserts the region before the extension of an output path, so
+// that the runs of each region write their own file, e.g. report.RegionOne.json
+// or images.RegionOne.tf.json.
+func regionPath(path, region string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	for _, e := range multiPartExtensions {
+		if strings.HasSuffix(path, e) {
+			ext = e
+		}
+	}
+	return strings.TrimSuffix(path, ext) + "." + region + ext
+}
+
+// postProcess applies the retention to the images of one region.
+func (p *OpenStackPostProcessor) postProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	start := time.Now()
+
+	if p.conn == nil {
+		log.Println("Creating OpenStack connection")
+		conn, err := p.imageV2Client()
+		if err != nil {
+			log.Println(err)
+			return nil, true, false, err
+		}
+		p.conn = conn
+	}
+
+	if p.config.CheckOnly {
+		err := images.List(p.conn, images.ListOpts{Limit: 1}).EachPage(func(page pagination.Page) (bool, error) {
+			_, err := images.ExtractImages(page)
+			return false, err
+		})
+		if err != nil {
+			return nil, true, false, fmt.Errorf("failed to list images: %s", err)
+		}
+		ui.Message("Authentication and image service access checked successfully")
+		return artifact, true, false, nil
+	}
+
+	if len(p.config.MetadataTargetIDs) > 0 {
+		for _, id := range p.config.MetadataTargetIDs {
+			img, err := images.Get(p.conn, id).Extract()
+			if err != nil {
+				return nil, true, false, err
+			}
+			ui.Message(fmt.Sprintf("Updating meta for target image: %s %s", img.Name, img.ID))
+			if err := p.updateImageMeta(*img, append(p.removeProperties(), p.config.StripProperties...)); err != nil {
+				return nil, true, false, err
+			}
+		}
+		return artifact, true, false, nil
+	}
+
+	// With a plan_file, a first run only plans, and the next one applies the
+	// plan once approved.
+	planning := false
+	if p.config.PlanFile != "" {
+		if _, err := os.Stat(p.config.PlanFile); os.IsNotExist(err) {
+			planning = true
+		} else if _, err := os.Stat(p.config.ApprovalFile); os.IsNotExist(err) {
+			return nil, true, false, fmt.Errorf("plan %s is waiting for approval, create %s to apply it", p.config.PlanFile, p.config.ApprovalFile)
+		}
+	}
+
+	if p.config.CountOwnedOnly {
+		project, err := p.projectID()
+		if err != nil {
+			return nil, true, false, err
+		}
+		p.project = project
+	}
+
+	if p.config.ManifestImageName != "" {
+		ids, err := p.manifestImageIDs()
+		if err != nil {
+			return nil, true, false, err
+		}
+		p.manifestIDs = ids
+	}
+
+	log.Println("Describing images for generation management")
+	imageList, err := p.listImages(ui)
+	if err != nil {
+		return nil, true, false, err
+	}
+	if p.config.MultiMatchPolicy == multiMatchError {
+		for _, img := range imageList {
+			if families := p.matchingFamilies(img); len(families) > 1 {
+				return nil, true, false, fmt.Errorf("image %s %s matches several families (%s), which multi_match_policy %s forbids", img.Name, img.ID, strings.Join(families, ", "), multiMatchError)
+			}
+		}
+	}
+
+	if len(imageList) == 0 && !p.config.WarnOnEmptyList.False() {
+		p.warnEmptyList(ui)
+	}
+
+	p.sortImages(imageList)
+
+	actions := &actionEmitter{out: p.ndjson}
+	now := p.retentionNow(imageList)
+
+	var managed []images.Image
+	for _, img := range imageList {
+		if reason := p.skipReason(img); reason != "" {
+			ui.Message(fmt.Sprintf("Skipping image: %s %s (%s)", img.Name, img.ID, reason))
+			actions.Emit(actionSkip, img, reason)
+			continue
+		}
+		managed = append(managed, img)
+	}
+
+	kept, expired, keepReasons := p.partitionImages(managed, now)
+
+	if p.config.deletion != nil {
+		var matched []images.Image
+		for _, img := range kept {
+			ok, err := p.config.deletion.Match(p, img, now)
+			if err != nil {
+				return nil, true, false, err
+			}
+			if ok {
+				ui.Message(fmt.Sprintf("Image matches delete_expression: %s %s", img.Name, img.ID))
+				delete(keepReasons, img.ID)
+				matched = append(matched, img)
+			}
+		}
+		kept = excludeImages(kept, matched)
+		expired = append(expired, matched...)
+		p.sortImages(expired)
+	}
+
+	var review []images.Image
+	for _, img := range expired {
+		if reason := p.reviewReason(img); reason != "" {
+			ui.Message(fmt.Sprintf("Keeping image pending review: %s %s (%s)", img.Name, img.ID, reason))
+			actions.Emit(actionSkip, img, reason)
+			keepReasons[img.ID] = []string{reason}
+			review = append(review, img)
+		}
+	}
+	expired = excludeImages(expired, review)
+
+	if p.config.ProtectIfUpdatedWithin > 0 {
+		var recent []images.Image
+		for _, img := range expired {
+			if age := now.Sub(img.UpdatedAt); age < p.config.ProtectIfUpdatedWithin {
+				ui.Message(fmt.Sprintf("Keeping recently updated image: %s %s (updated %s ago)", img.Name, img.ID, formatAge(age)))
+				keepReasons[img.ID] = []string{"updated within protect_if_updated_within"}
+				recent = append(recent, img)
+			}
+		}
+		kept = append(kept, recent...)
+		p.sortImages(kept)
+		expired = excludeImages(expired, recent)
+	}
+
+	required, requiredBy := requiredImages(append(append([]images.Image{}, kept...), review...), expired, p.config.RequiresImageProperty)
+	for _, img := range required {
+		ui.Message(fmt.Sprintf("Keeping image required by %s: %s %s", requiredBy[img.ID], img.Name, img.ID))
+		keepReasons[img.ID] = []string{"required by image " + requiredBy[img.ID]}
+	}
+	kept = append(kept, required...)
+	p.sortImages(kept)
+	expired = excludeImages(expired, required)
+	unmanaged := actions.Count(actionSkip)
+
+	if len(kept) > 0 {
+		if missing := p.missingProperties(kept[0]); len(missing) > 0 {
+			err := fmt.Errorf("newest kept image %s %s lacks the required properties: %s", kept[0].Name, kept[0].ID, strings.Join(missing, ", "))
+			summarizeAbortedRun(ui, actions, &kept[0], err)
+			return nil, true, false, err
+		}
+	}
+
+	if p.config.ManageCurrentOnly {
+		if len(kept) == 0 {
+			ui.Message("No image to mark as current")
+			return artifact, true, false, nil
+		}
+		if err := p.manageCurrent(ui, managed, kept[0]); err != nil {
+			return nil, true, false, err
+		}
+		return artifact, true, false, nil
+	}
+
+	p.showPlan(ui, managed, keepReasons, now)
+
+	for _, img := range kept {
+		// strip_properties are removed from every kept image, the
+		// remove_properties only within update_meta_within.
+		names := p.config.StripProperties
+		if p.config.UpdateMetaWithin > 0 && now.Sub(imageCreatedAt(img)) > p.config.UpdateMetaWithin {
+			log.Printf("Not removing remove_properties from image older than %s (%s) (%s)", p.config.UpdateMetaWithin, img.Name, img.ID)
+		} else {
+			names = append(p.removeProperties(), names...)
+		}
+
+		if planning {
+			log.Printf("Not updating meta for image while planning (%s) (%s)", img.Name, img.ID)
+		} else if len(names) > 0 {
+			ui.Message(fmt.Sprintf("Updating meta for image: %s %s", img.Name, img.ID))
+			if err := p.updateImageMeta(img, names); err != nil {
+				summarizeAbortedRun(ui, actions, &img, err)
+				return nil, true, false, err
+			}
+		}
+		actions.Emit(actionKeep, img, strings.Join(keepReasons[img.ID], ", "))
+	}
+
+	if p.config.VerifySignature && len(kept) > 0 {
+		newest := kept[0]
+		ui.Message(fmt.Sprintf("Verifying signature of the newest kept image: %s %s", newest.Name, newest.ID))
+		if err := p.verifyImageSignature(newest); err != nil {
+			err = fmt.Errorf("signature verification of image %s failed: %s", newest.ID, err)
+			summarizeAbortedRun(ui, actions, &newest, err)
+			return nil, true, false, err
+		}
+	}
+
+	expired, err = p.excludeNotOlderThanArtifact(ui, actions, artifact, expired)
+	if err != nil {
+		summarizeAbortedRun(ui, actions, nil, err)
+		return nil, true, false, err
+	}
+
+	// The images left for a later run on purpose are not failed skips.
+	postponed := 0
+
+	// Orphans go through the same guards as the expired images.
+	orphaned := make(map[string]bool)
+	if p.config.SweepOrphans {
+		orphans, err := p.sweepOrphans(ui, artifact, append(append([]images.Image{}, kept...), review...), now)
+		if err != nil {
+			summarizeAbortedRun(ui, actions, nil, err)
+			return nil, true, false, err
+		}
+		for _, img := range orphans {
+			orphaned[img.ID] = true
+		}
+		expired = append(expired, orphans...)
+		p.sortImages(expired)
+	}
+
+	if len(expired) > 0 && p.config.window != nil && !p.config.window.Contains(time.Now()) {
+		ui.Message(fmt.Sprintf("Outside of maintenance window %q, skipping deletion of %d image(s)", p.config.MaintenanceWindow, len(expired)))
+		for _, img := range expired {
+			log.Printf("Skipping deletion of image outside maintenance window (%s) (%s)", img.Name, img.ID)
+			actions.Emit(actionSkip, img, "outside maintenance window")
+		}
+		postponed += len(expired)
+		expired = nil
+	}
+
+	if p.config.MaxDeletesPerRun > 0 && len(expired) > p.config.MaxDeletesPerRun {
+		ui.Message(fmt.Sprintf("Limiting deletion to the %d oldest of %d expired image(s)", p.config.MaxDeletesPerRun, len(expired)))
+		var deferred []images.Image
+		expired, deferred = limitDeletions(expired, p.config.MaxDeletesPerRun, p.config.BaseImageProperty)
+		for _, img := range deferred {
+			actions.Emit(actionSkip, img, "max_deletes_per_run reached")
+		}
+		postponed += len(deferred)
+	}
+
+	if planning {
+		if err := writeDeletionPlan(p.config.PlanFile, newDeletionPlan(p.families(), expired, time.Now())); err != nil {
+			return nil, true, false, err
+		}
+		ui.Say(fmt.Sprintf("Wrote the plan to delete %d image(s) to %s. Create %s to approve it, and run again to apply it.", len(expired), p.config.PlanFile, p.config.ApprovalFile))
+		return artifact, true, false, nil
+	}
+	if p.config.PlanFile != "" {
+		plan, err := readDeletionPlan(p.config.PlanFile)
+		if err != nil {
+			return nil, true, false, err
+		}
+		if expired, err = plan.Match(expired); err != nil {
+			return nil, true, false, fmt.Errorf("plan %s is no longer valid, delete it to plan again: %s", p.config.PlanFile, err)
+		}
+		ui.Message(fmt.Sprintf("Applying the approved plan %s", p.config.PlanFile))
+	}
+
+	expired = orderDeletions(expired, p.config.BaseImageProperty)
+
+	if p.config.DeleteScriptOutput != "" {
+		if err := writeDeleteScript(p.config.DeleteScriptOutput, expired, now); err != nil {
+			return nil, true, false, fmt.Errorf("failed to write the delete script: %s", err)
+		}
+		ui.Say(fmt.Sprintf("Wrote the script to delete %d image(s) to %s, nothing was deleted", len(expired), p.config.DeleteScriptOutput))
+		return artifact, true, false, nil
+	}
+
+	if p.config.CheckQuota != "" {
+		usage, err := p.imageUsage()
+		if err != nil {
+			return nil, true, false, err
+		}
+		if problems := quotaProblems(usage, expired); len(problems) > 0 {
+			msg := fmt.Sprintf("the planned deletions would leave no image quota headroom: %s", strings.Join(problems, ", "))
+			if p.config.CheckQuota == onFailureError {
+				return nil, true, false, fmt.Errorf("%s", msg)
+			}
+			ui.Error("Warning: " + msg)
+		} else {
+			ui.Message("The planned deletions leave image quota headroom")
+		}
+	}
+
+	var notifier *amqpNotifier
+	if p.config.NotifyAMQPURL != "" && len(expired) > 0 {
+		// The URL usually holds credentials, so it is not shown.
+		if notifier, err = newAMQPNotifier(p.config.NotifyAMQPURL, p.config.NotifyAMQPExchange, p.config.NotifyAMQPRoutingKey); err != nil {
+			ui.Error(fmt.Sprintf("Warning: failed to connect to the notification bus, not sending notifications: %s", err))
+		} else {
+			defer notifier.Close()
+		}
+	}
+
+	var resume *checkpoint
+	if p.config.CheckpointFile != "" {
+		if resume, err = loadCheckpoint(p.config.CheckpointFile); err != nil {
+			return nil, true, false, err
+		}
+	}
+
+	for _, img := range expired {
+		if resume != nil && resume.Deleted(img.ID) {
+			ui.Message(fmt.Sprintf("Skipping image already deleted by a previous run: %s %s", img.Name, img.ID))
+			continue
+		}
+
+		if img.Protected {
+			ui.Message(fmt.Sprintf("Skipping protected image: %s %s", img.Name, img.ID))
+			actions.Emit(actionSkip, img, "image is protected")
+			continue
+		}
+
+		if p.config.ArchiveToSwift != "" {
+			ui.Message(fmt.Sprintf("Archiving image to Swift: %s %s", img.Name, img.ID))
+			object, err := p.archiveImage(img)
+			switch {
+			case err == nil:
+				ui.Message(fmt.Sprintf("Archived image %s to %s", img.ID, object))
+			case p.config.ArchiveOnFailure == archiveFailureDelete:
+				ui.Error(fmt.Sprintf("Failed to archive image %s, deleting it anyway: %s", img.ID, err))
+			default:
+				ui.Error(fmt.Sprintf("Failed to archive image %s, not deleting it: %s", img.ID, err))
+				actions.Emit(actionSkip, img, "archive failed")
+				continue
+			}
+		}
+
+		if p.config.RecoveryManifest != "" {
+			// Written before deleting, so that even an interrupted run
+			// leaves the images it may have deleted in the manifest.
+			p.recordRecovery(newRecoveryImage(img, p.config.Region, time.Now()))
+			if err := p.writeRecoveryManifest(); err != nil {
+				summarizeAbortedRun(ui, actions, &img, err)
+				return nil, true, false, err
+			}
+		}
+
+		ui.Message(fmt.Sprintf("Deleting duplicating image: %s %s", img.Name, img.ID))
+		log.Printf("Deleting duplicating image (%s) (%s)", img.Name, img.ID)
+		err := p.withReauth(func() error { return images.Delete(p.conn, img.ID).Err })
+		if _, ok := err.(gophercloud.ErrDefault404); ok && resume != nil {
+			// Deleted in the meantime, which a resumed run treats
+			// as done.
+			log.Printf("Image already gone (%s) (%s)", img.Name, img.ID)
+			err = nil
+		}
+		if err != nil {
+			if _, ok := err.(gophercloud.ErrDefault409); ok {
+				ui.Message(fmt.Sprintf("Skipping image in use: %s %s", img.Name, img.ID))
+				actions.Emit(actionSkip, img, "image is in use")
+				if p.config.RecoveryManifest != "" {
+					// The image is still there.
+					p.forgetRecovery(img.ID)
+					if err := p.writeRecoveryManifest(); err != nil {
+						summarizeAbortedRun(ui, actions, &img, err)
+						return nil, true, false, err
+					}
+				}
+				continue
+			}
+			summarizeAbortedRun(ui, actions, &img, err)
+			return nil, true, false, err
+		}
+		reason := ""
+		if orphaned[img.ID] {
+			reason = "orphaned"
+		}
+		actions.Emit(actionDelete, img, reason)
+		if resume != nil {
+			if err := resume.Record(img.ID); err != nil {
+				summarizeAbortedRun(ui, actions, &img, err)
+				return nil, true, false, fmt.Errorf("failed to update checkpoint %s: %s", p.config.CheckpointFile, err)
+			}
+		}
+		if notifier != nil {
+			if err := notifier.NotifyDeleted(img, p.family(img)); err != nil {
+				log.Printf("Failed to send deletion notification (%s): %s", img.ID, err)
+			}
+		}
+	}
+
+	if p.config.CheckpointFile != "" {
+		// The run completed, the next one starts over.
+		if err := os.Remove(p.config.CheckpointFile); err != nil && !os.IsNotExist(err) {
+			ui.Error(fmt.Sprintf("Warning: failed to remove %s: %s", p.config.CheckpointFile, err))
+		}
+	}
+
+	if p.config.PlanFile != "" {
+		// The plan is applied, the next run plans again.
+		for _, path := range []string{p.config.PlanFile, p.config.ApprovalFile} {
+			if err := os.Remove(path); err != nil {
+				ui.Error(fmt.Sprintf("Warning: failed to remove %s: %s", path, err))
+			}
+		}
+	}
+
+	if p.config.TerraformOutput != "" {
+		ui.Message(fmt.Sprintf("Writing Terraform import data for kept images: %s", p.config.TerraformOutput))
+		kept := append(append([]images.Image{}, kept...), review...)
+		p.sortImages(kept)
+		if err := writeTerraformOutput(p.config.TerraformOutput, kept); err != nil {
+			summarizeAbortedRun(ui, actions, nil, err)
+			return nil, true, false, err
+		}
+	}
+
+	if p.config.StatsdAddress != "" {
+		if err := sendStatsd(p.config.StatsdAddress, p.config.StatsdPrefix, actions, time.Since(start)); err != nil {
+			log.Printf("Failed to send metrics to StatsD (%s): %s", p.config.StatsdAddress, err)
+		}
+	}
+
+	if err := p.reportRun(ctx, ui, actions); err != nil {
+		summarizeAbortedRun(ui, actions, nil, err)
+		return nil, true, false, err
+	}
+
+	if p.config.CIOutputFormat != "" {
+		newestID := ""
+		if len(kept) > 0 {
+			newestID = kept[0].ID
+		}
+		if err := p.writeCIOutput(actions, newestID); err != nil {
+			err = fmt.Errorf("failed to write the CI outputs: %s", err)
+			summarizeAbortedRun(ui, actions, nil, err)
+			return nil, true, false, err
+		}
+	}
+
+	if skipped := actions.Count(actionSkip) - unmanaged - postponed; p.config.FailOnSkips && skipped > 0 {
+		err := fmt.Errorf("%d image(s) could not be deleted as planned", skipped)
+		summarizeAbortedRun(ui, actions, nil, err)
+		return nil, true, false, err
+	}
+
+	return artifact, true, false, nil
+}
+
+// warnEmptyList warns that no image matched, which may also be caused by a
+// token scoped to the wrong project. With empty_list_visible_check, it lists
+// a single image without any filter to tell both cases apart.
+func (p *OpenStackPostProcessor) warnEmptyList(ui packer.Ui) {
+	var names []string
+	for _, identifier := range p.identifiers() {
+		names = append(names, fmt.Sprintf("named %q", identifier))
+	}
+	for _, prefix := range p.config.Prefixes {
+		names = append(names, fmt.Sprintf("prefixed %q", prefix))
+	}
+	ui.Error(fmt.Sprintf("Warning: no images %s were found. If images are expected, check the project scope of the credentials.", strings.Join(names, " or ")))
+	if !p.config.EmptyListVisibleCheck {
+		return
+	}
+
+	visible := 0
+	err := images.List(p.conn, images.ListOpts{Limit: 1}).EachPage(func(page pagination.Page) (bool, error) {
+		imgs, err := images.ExtractImages(page)
+		visible = len(imgs)
+		return false, err
+	})
+	switch {
+	case err != nil:
+		ui.Error(fmt.Sprintf("Warning: failed to list images without a name filter: %s", err))
+	case visible == 0:
+		ui.Error("Warning: no images are visible at all, the credentials are probably scoped to the wrong project.")
+	default:
+		ui.Message("Other images are visible, so no image matches the identifier.")
+	}
+}
+
+// summarizeAbortedRun reports what a failed run already did, and the image
+// it failed on if any, since the deletions so far are not rolled back.
+func summarizeAbortedRun(ui packer.Ui, actions *actionEmitter, failed *images.Image, err error) {
+	ui.Error(fmt.Sprintf("Run aborted: %d image(s) deleted, %d kept and %d skipped so far",
+		actions.Count(actionDelete), actions.Count(actionKeep), actions.Count(actionSkip)))
+	if failed != nil {
+		ui.Error(fmt.Sprintf("Failed on image: %s %s: %s", failed.Name, failed.ID, err))
+	}
+}
+
+// showPlan lists the managed images newest first with their age, and the
+// reasons for the kept ones, so that the boundary between kept and deleted
+// images is easy to check.
+func (p *OpenStackPostProcessor) showPlan(ui packer.Ui, managed []images.Image, keepReasons map[string][]string, now time.Time) {
+	for _, img := range managed {
+		action := actionDelete
+		if len(keepReasons[img.ID]) > 0 {
+			action = actionKeep
+		}
+		created := "creation time unknown"
+		if age := imageAge(img, now); age != "" {
+			created = fmt.Sprintf("created %s, %s old", imageCreatedAt(img).UTC().Format(time.RFC3339), age)
+		}
+		if action == actionKeep {
+			created += "; " + strings.Join(keepReasons[img.ID], ", ")
+		}
+		ui.Message(fmt.Sprintf("Plan: %-6s %s %s (%s)", action, img.Name, img.ID, created))
+	}
+}
+
+// identifiers returns identifier followed by identifiers, without duplicates.
+func (p *OpenStackPostProcessor) identifiers() []string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, identifier := range append([]string{p.config.Identifier}, p.config.Identifiers...) {
+		if identifier == "" || seen[identifier] {
+			continue
+		}
+		seen[identifier] = true
+		list = append(list, identifier)
+	}
+	return list
+}
+
+// families returns the identifiers followed by the prefixes, without
+// duplicates. Each of them is a family of images with its own retention.
+func (p *OpenStackPostProcessor) families() []string {
+	list := p.identifiers()
+	seen := make(map[string]bool)
+	for _, identifier := range list {
+		seen[identifier] = true
+	}
+	for _, prefix := range p.config.Prefixes {
+		if !seen[prefix] {
+			seen[prefix] = true
+			list = append(list, prefix)
+		}
+	}
+	return list
+}
+
+// The multi_match_policy values.
+const (
+	multiMatchFirst = "first"
+	multiMatchAll   = "all"
+	multiMatchError = "error"
+)
+
+// family returns the family an image belongs to, or an empty string if it
+// matches none. Exact identifiers take precedence, then the first matching
+// prefix wins.
+func (p *OpenStackPostProcessor) family(img images.Image) string {
+	if families := p.matchingFamilies(img); len(families) > 0 {
+		return families[0]
+	}
+	return ""
+}
+
+// matchingFamilies returns all the families an image matches, the matching
+// identifier first, then the prefixes in order.
+func (p *OpenStackPostProcessor) matchingFamilies(img images.Image) []string {
+	var families []string
+	seen := make(map[string]bool)
+	for _, identifier := range p.identifiers() {
+		if img.Name == identifier {
+			families = append(families, identifier)
+			seen[identifier] = true
+		}
+	}
+	for _, prefix := range p.config.Prefixes {
+		if strings.HasPrefix(img.Name, prefix) && !seen[prefix] {
+			families = append(families, prefix)
+			seen[prefix] = true
+		}
+	}
+	return families
+}
+
+// imageFamilies returns the families whose retention an image counts
+// against: every matching family with multi_match_policy all, and the first
+// one otherwise.
+func (p *OpenStackPostProcessor) imageFamilies(img images.Image) []string {
+	families := p.matchingFamilies(img)
+	if p.config.MultiMatchPolicy != multiMatchAll && len(families) > 1 {
+		families = families[:1]
+	}
+	if len(families) == 0 {
+		families = []string{""}
+	}
+	return families
+}
+
+// listImages lists the images of all families. Glance cannot filter names
+// by prefix, so with prefixes all images are listed and filtered here.
+func (p *OpenStackPostProcessor) listImages(ui packer.Ui) ([]images.Image, error) {
+	var imageList []images.Image
+	list := func(opts images.ListOpts) error {
+		if p.config.MaxPages > 0 {
+			// Newest first, so that the pages read cover the images
+			// that matter for retention.
+			opts.SortKey = "created_at"
+			opts.SortDir = "desc"
+		}
+
+		pages := 0
+		return images.List(p.conn, opts).EachPage(func(page pagination.Page) (bool, error) {
+			imgs, err := images.ExtractImages(page)
+			if err != nil {
+				return false, err
+			}
+
+			imageList = append(imageList, imgs...)
+			pages++
+			if p.config.MaxPages > 0 && pages >= p.config.MaxPages {
+				if next, _ := page.(images.ImagePage).NextPageURL(); next != "" {
+					ui.Error(fmt.Sprintf("Warning: stopped listing images after max_pages (%d) pages, older images are left untouched", p.config.MaxPages))
+				}
+				return false, nil
+			}
+			return true, nil
+		})
+	}
+
+	if len(p.config.Prefixes) > 0 {
+		if err := p.withReauth(func() error {
+			imageList = nil
+			return list(images.ListOpts{})
+		}); err != nil {
+			return nil, err
+		}
+		var matched []images.Image
+		for _, img := range imageList {
+			if p.family(img) != "" {
+				matched = append(matched, img)
+			}
+		}
+		return matched, nil
+	}
+
+	for _, identifier := range p.identifiers() {
+		n := len(imageList)
+		if err := p.withReauth(func() error {
+			imageList = imageList[:n]
+			return list(images.ListOpts{Name: identifier})
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return imageList, nil
 }
 
-type OpenStackPostProcessor struct {
-	config Config
-	conn   *gophercloud.ServiceClient
+// keepReleases returns the number of releases to keep for an identifier.
+func (p *OpenStackPostProcessor) keepReleases(identifier string) int {
+	if keep, ok := p.config.KeepReleasesByIdentifier[identifier]; ok {
+		return keep
+	}
+	return p.config.KeepReleases
 }
 
-func (p *OpenStackPostProcessor) ConfigSpec() hcldec.ObjectSpec {
-	return p.config.FlatMapstructure().HCL2Spec()
+// anchorNowEpsilon is the time assumed to have passed since the newest image
+// was created, with anchor_now_to_newest.
+const anchorNowEpsilon = time.Minute
+
+// retentionNow returns the time ages are computed against: the local clock,
+// or with anchor_now_to_newest, the creation of the newest image plus
+// anchorNowEpsilon, so that the clock of the build host does not matter.
+func (p *OpenStackPostProcessor) retentionNow(imageList []images.Image) time.Time {
+	if !p.config.AnchorNowToNewest {
+		return time.Now()
+	}
+	var newest time.Time
+	for _, img := range imageList {
+		if created := imageCreatedAt(img); created.After(newest) {
+			newest = created
+		}
+	}
+	if newest.IsZero() {
+		return time.Now()
+	}
+	return newest.Add(anchorNowEpsilon)
 }
 
-func (p *OpenStackPostProcessor) Configure(raws ...interface{}) error {
-	err := config.Decode(&p.config, &config.DecodeOpts{
-		Interpolate:        true,
-		InterpolateContext: &p.config.ctx,
-	}, raws...)
+// sortImages sorts images by sort_by, and newest first otherwise.
+func (p *OpenStackPostProcessor) sortImages(imageList []images.Image) {
+	sortImages(imageList)
+
+	name := strings.TrimPrefix(p.config.SortBy, sortByPropertyPrefix)
+	if name == p.config.SortBy {
+		return
+	}
+	sort.SliceStable(imageList, func(i, j int) bool {
+		vi, iok := p.property(imageList[i], name)
+		vj, jok := p.property(imageList[j], name)
+		if iok != jok {
+			return iok
+		}
+		return comparePropertyValues(vi, vj) > 0
+	})
+}
+
+// sortImages sorts images newest first.
+func sortImages(imageList []images.Image) {
+	sort.SliceStable(imageList, func(i, j int) bool {
+		return imageCreatedAt(imageList[i]).After(imageCreatedAt(imageList[j]))
+	})
+}
+
+// skipReason returns why an image must be left untouched by retention, or an
+// empty string if it is managed.
+func (p *OpenStackPostProcessor) skipReason(img images.Image) string {
+	if p.protectedIDs()[img.ID] {
+		return "listed in protected_ids"
+	}
+	if p.manifestIDs[img.ID] {
+		return fmt.Sprintf("referenced by manifest image %s", p.config.ManifestImageName)
+	}
+
+	if p.config.CountOwnedOnly && img.Owner != p.project {
+		return fmt.Sprintf("owned by project %s", img.Owner)
+	}
+
+	var names []string
+	for name := range p.config.SkipIfPropertyEquals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := p.config.SkipIfPropertyEquals[name]
+		if v, ok := p.property(img, name); ok && v == value {
+			return fmt.Sprintf("property %s is %s", name, value)
+		}
+	}
+
+	names = names[:0]
+	for name := range p.config.MatchProperties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := p.config.MatchProperties[name]
+		if v, _ := p.property(img, name); v != value {
+			return fmt.Sprintf("property %s does not match %s", name, value)
+		}
+	}
+
+	if len(p.config.ManageOnlyTeams) > 0 {
+		team, _ := p.property(img, ownerTeamProperty)
+		managed := false
+		for _, t := range p.config.ManageOnlyTeams {
+			if team == t {
+				managed = true
+				break
+			}
+		}
+		if !managed {
+			return fmt.Sprintf("%s %q is not managed", ownerTeamProperty, team)
+		}
+	}
+
+	return ""
+}
+
+// reviewReason returns why an image awaits a human decision and must be kept
+// whatever the keep rules say, or an empty string.
+func (p *OpenStackPostProcessor) reviewReason(img images.Image) string {
+	for _, name := range p.config.ExcludeIfPropertyTruthy {
+		if v, ok := p.property(img, name); ok && isTruthy(v) {
+			return fmt.Sprintf("pending review, property %s is %s", name, v)
+		}
+	}
+	return ""
+}
+
+// requiredImages returns the candidates referenced by the property of a kept
+// image, directly or through another required image, in the candidates
+// order, and the image each of them is required by.
+func requiredImages(kept, candidates []images.Image, property string) ([]images.Image, map[string]string) {
+	byID := make(map[string]images.Image)
+	for _, img := range candidates {
+		byID[img.ID] = img
+	}
+
+	requiredBy := make(map[string]string)
+	queue := append([]images.Image{}, kept...)
+	for len(queue) > 0 {
+		img := queue[0]
+		queue = queue[1:]
+		id, ok := imageProperty(img, property)
+		if !ok {
+			continue
+		}
+		if dep, ok := byID[id]; ok && requiredBy[id] == "" {
+			requiredBy[id] = img.ID
+			queue = append(queue, dep)
+		}
+	}
+
+	var required []images.Image
+	for _, img := range candidates {
+		if requiredBy[img.ID] != "" {
+			required = append(required, img)
+		}
+	}
+	return required, requiredBy
+}
+
+// excludeImages returns the images of the list that are not in exclude.
+func excludeImages(imageList, exclude []images.Image) []images.Image {
+	excluded := make(map[string]bool)
+	for _, img := range exclude {
+		excluded[img.ID] = true
+	}
+
+	var remaining []images.Image
+	for _, img := range imageList {
+		if !excluded[img.ID] {
+			remaining = append(remaining, img)
+		}
+	}
+	return remaining
+}
+
+// excludeNotOlderThanArtifact removes the image built by the OpenStack builder,
+// and every image created after it, from the images to delete. This protects
+// images produced concurrently by other builds.
+func (p *OpenStackPostProcessor) excludeNotOlderThanArtifact(ui packer.Ui, actions *actionEmitter, artifact packer.Artifact, expired []images.Image) ([]images.Image, error) {
+	if artifact == nil || artifact.BuilderId() != openstack.BuilderId {
+		return expired, nil
+	}
+
+	built, err := images.Get(p.conn, artifact.Id()).Extract()
+	if _, ok := err.(gophercloud.ErrDefault404); ok && len(p.config.Regions) > 0 {
+		// The image was built in another region.
+		return expired, nil
+	}
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to describe built image %s: %s", artifact.Id(), err)
 	}
 
-	var errs *packer.MultiError
-	errs = packer.MultiErrorAppend(errs, p.config.AccessConfig.Prepare(&p.config.ctx)...)
-	if len(errs.Errors) > 0 {
-		return errs
+	var remaining []images.Image
+	for _, img := range expired {
+		if img.ID == built.ID || imageCreatedAt(img).After(imageCreatedAt(*built)) {
+			ui.Message(fmt.Sprintf("Skipping image not older than the built image: %s %s", img.Name, img.ID))
+			actions.Emit(actionSkip, img, "not older than the built image")
+			continue
+		}
+		remaining = append(remaining, img)
 	}
+	return remaining, nil
+}
 
-	log.Println(p.config)
-	return nil
+// orderDeletions orders the images so that images based on another image in
+// the list are deleted before their base image. Unrelated images keep their
+// order.
+func orderDeletions(imageList []images.Image, baseProperty string) []images.Image {
+	if baseProperty == "" {
+		return imageList
+	}
+
+	inList := make(map[string]bool)
+	for _, img := range imageList {
+		inList[img.ID] = true
+	}
+
+	children := make(map[string][]images.Image)
+	for _, img := range imageList {
+		if base, ok := imageProperty(img, baseProperty); ok && inList[base] && base != img.ID {
+			children[base] = append(children[base], img)
+		}
+	}
+
+	var ordered []images.Image
+	visited := make(map[string]bool)
+	var visit func(img images.Image)
+	visit = func(img images.Image) {
+		if visited[img.ID] {
+			return
+		}
+		visited[img.ID] = true
+		for _, child := range children[img.ID] {
+			visit(child)
+		}
+		ordered = append(ordered, img)
+	}
+	for _, img := range imageList {
+		visit(img)
+	}
+	return ordered
 }
 
-func (p *OpenStackPostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
-	log.Println("Running OpenStack Image Management Post-Processor")
+// limitDeletions selects at most max images to delete, oldest first, from
+// images sorted newest first. An image is only selected along with the images
+// in the list based on it, so that no dependent image is left behind its
+// deleted base image. Both lists keep the order of images.
+func limitDeletions(imageList []images.Image, max int, baseProperty string) ([]images.Image, []images.Image) {
+	children := make(map[string][]string)
+	if baseProperty != "" {
+		for _, img := range imageList {
+			if base, ok := imageProperty(img, baseProperty); ok && base != img.ID {
+				children[base] = append(children[base], img.ID)
+			}
+		}
+	}
 
-	if p.conn == nil {
-		log.Println("Creating OpenStack connection")
-		conn, err := p.imageV2Client()
-		if err != nil {
-			log.Println(err)
-			return nil, true, false, err
+	selected := make(map[string]bool)
+	for i := len(imageList) - 1; i >= 0 && len(selected) < max; i-- {
+		group := make(map[string]bool)
+		queue := []string{imageList[i].ID}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			if group[id] || selected[id] {
+				continue
+			}
+			group[id] = true
+			queue = append(queue, children[id]...)
+		}
+		if len(selected)+len(group) > max {
+			continue
+		}
+		for id := range group {
+			selected[id] = true
 		}
-		p.conn = conn
 	}
 
-	var imageList []images.Image
+	var limited, deferred []images.Image
+	for _, img := range imageList {
+		if selected[img.ID] {
+			limited = append(limited, img)
+		} else {
+			deferred = append(deferred, img)
+		}
+	}
+	return limited, deferred
+}
 
-	log.Println("Describing images for generation management")
-	pager := images.List(p.conn, images.ListOpts{Name: p.config.Identifier})
-	if err := pager.EachPage(func(page pagination.Page) (bool, error) {
-		imgs, err := images.ExtractImages(page)
-		if err != nil {
-			return false, err
+// missingProperties returns the required_properties the image lacks or has
+// empty.
+func (p *OpenStackPostProcessor) missingProperties(img images.Image) []string {
+	var missing []string
+	for _, name := range p.config.RequiredProperties {
+		if v, _ := imageProperty(img, name); v == "" {
+			missing = append(missing, name)
 		}
+	}
+	return missing
+}
 
-		imageList = append(imageList, imgs...)
-		return true, nil
-	}); err != nil {
-		return nil, true, false, err
+// removeProperties returns the remove_properties, or the default ones when
+// unset.
+func (p *OpenStackPostProcessor) removeProperties() []string {
+	if p.config.RemoveProperties == nil {
+		return append([]string(nil), defaultRemoveProperties...)
+	}
+	return append([]string(nil), p.config.RemoveProperties...)
+}
+
+// updateImageMeta removes the named properties from a kept image.
+// Properties the image does not have are left out, since Glance refuses to
+// remove them, and reserved attributes are never touched.
+func (p *OpenStackPostProcessor) updateImageMeta(img images.Image, names []string) error {
+	var updateOpts images.UpdateOpts
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if reservedProperties[name] {
+			log.Printf("Not removing reserved attribute %s from image (%s)", name, img.ID)
+			continue
+		}
+		if _, ok := img.Properties[name]; !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		updateOpts = append(updateOpts, images.UpdateImageProperty{
+			Op:   images.RemoveOp,
+			Name: name,
+		})
 	}
 
-	sort.Slice(imageList, func(i, j int) bool {
-		return imageList[i].CreatedAt.After(imageList[j].CreatedAt)
-	})
+	if len(updateOpts) == 0 {
+		log.Printf("No properties to remove from image (%s)", img.ID)
+		return nil
+	}
+	return p.withReauth(func() error { return images.Update(p.conn, img.ID, updateOpts).Err })
+}
 
+// partitionImages splits the sorted image list into the images to keep and
+// the images to delete, preserving the newest-first order in both, and
+// returns the reasons each kept image is kept for by image ID. The keep
+// rules apply to each group of images separately, and every identifier forms
+// its own groups. An image in several groups is kept if any of them keeps it.
+func (p *OpenStackPostProcessor) partitionImages(imageList []images.Image, now time.Time) ([]images.Image, []images.Image, map[string][]string) {
+	var keys []string
+	groups := make(map[string][]int)
+	groupFamilies := make(map[string]string)
+	groupRules := make(map[string]int)
 	for i, img := range imageList {
-		if i < p.config.KeepReleases {
-			ui.Message(fmt.Sprintf("Updating meta for image: %s %s", img.Name, img.ID))
-			updateOpts := images.UpdateOpts{
-				images.UpdateImageProperty{
-					Op:   images.RemoveOp,
-					Name: "signature_verified",
-				},
+		rule := p.ruleIndex(img)
+		for _, family := range p.imageFamilies(img) {
+			key := p.groupKey(img, family)
+			if rule >= 0 {
+				key += fmt.Sprintf("\x00rule%d", rule)
+			}
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+				groupFamilies[key] = family
+				groupRules[key] = rule
+			}
+			groups[key] = append(groups[key], i)
+		}
+	}
+
+	reasons := make([][]string, len(imageList))
+	for _, key := range keys {
+		group := make([]images.Image, len(groups[key]))
+		for j, i := range groups[key] {
+			group[j] = imageList[i]
+		}
+		var selected [][]string
+		if rule := groupRules[key]; rule >= 0 {
+			selected = selectByRule(group, p.config.Rules[rule], now)
+		} else {
+			selected = p.selectImages(group, p.keepReleases(groupFamilies[key]), now)
+		}
+		for j, r := range selected {
+			i := groups[key][j]
+			for _, reason := range r {
+				if !containsString(reasons[i], reason) {
+					reasons[i] = append(reasons[i], reason)
+				}
+			}
+		}
+	}
+
+	var kept, expired []images.Image
+	keepReasons := make(map[string][]string)
+	for i, img := range imageList {
+		if len(reasons[i]) > 0 {
+			kept = append(kept, img)
+			keepReasons[img.ID] = reasons[i]
+		} else {
+			expired = append(expired, img)
+		}
+	}
+	return kept, expired, keepReasons
+}
+
+// containsString reports whether the list contains the string.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// groupKey returns the retention group of an image within a family.
+func (p *OpenStackPostProcessor) groupKey(img images.Image, family string) string {
+	key := family
+	if p.config.ManageSnapshots {
+		v, _ := p.property(img, p.config.SnapshotGroupProperty)
+		key += "\x00" + v
+	}
+	return key
+}
+
+// selectImages applies the keep rules to a sorted group of images and
+// returns the reasons to keep each of them, which are empty for the images
+// to delete. keep is the number of releases to keep.
+func (p *OpenStackPostProcessor) selectImages(imageList []images.Image, keep int, now time.Time) [][]string {
+	reasons := make([][]string, len(imageList))
+
+	switch {
+	case p.config.ManualDeleteProperty != "":
+		// Only the images flagged by a human are deleted.
+		for i, img := range imageList {
+			v, _ := p.property(img, p.config.ManualDeleteProperty)
+			if !isTruthy(v) {
+				reasons[i] = append(reasons[i], "not flagged by manual_delete_property")
+			}
+		}
+		return reasons
+	case p.config.DedupeSameName:
+		// Only the newest image of each name is kept.
+		seen := make(map[string]bool)
+		for i, img := range imageList {
+			if !seen[img.Name] {
+				reasons[i] = append(reasons[i], "newest image of its name")
+			}
+			seen[img.Name] = true
+		}
+		return reasons
+	case p.config.GroupByProperty != "":
+		p.selectPerGroup(imageList, reasons)
+	case p.config.KeepByScore:
+		p.selectByScore(imageList, reasons, keep)
+	case p.config.SuccessProperty != "":
+		p.selectBySuccess(imageList, reasons, keep)
+	case p.config.KeepUntilSuperseded > 0:
+		selectUntilSuperseded(imageList, reasons, p.config.KeepUntilSuperseded)
+	default:
+		p.selectNewest(imageList, reasons, keep)
+	}
+
+	if p.config.KeepWeekly > 0 {
+		selectWeekly(imageList, reasons, p.config.KeepWeekly, now)
+	}
+
+	return reasons
+}
+
+// selectNewest selects the keep newest images, preferring distinct checksums
+// when configured.
+func (p *OpenStackPostProcessor) selectNewest(imageList []images.Image, reasons [][]string, keep int) {
+	n := 0
+
+	if p.config.PreferDistinctChecksums {
+		seen := make(map[string]bool)
+		for i, img := range imageList {
+			if n >= keep {
+				break
+			}
+			if img.Checksum != "" && seen[img.Checksum] {
+				continue
 			}
-			if result := images.Update(p.conn, img.ID, updateOpts); result.Err != nil {
-				return nil, true, false, result.Err
+			seen[img.Checksum] = true
+			reasons[i] = append(reasons[i], "within keep_releases")
+			n++
+		}
+	}
+
+	for i := range imageList {
+		if n >= keep {
+			break
+		}
+		if len(reasons[i]) == 0 {
+			reasons[i] = append(reasons[i], "within keep_releases")
+			n++
+		}
+	}
+}
+
+// selectBySuccess selects the keep newest successful images and the
+// keep_failed_releases newest failed ones, according to success_property.
+func (p *OpenStackPostProcessor) selectBySuccess(imageList []images.Image, reasons [][]string, keep int) {
+	var succeeded, failed []int
+	for i, img := range imageList {
+		if v, _ := p.property(img, p.config.SuccessProperty); v == p.config.SuccessValue {
+			succeeded = append(succeeded, i)
+		} else {
+			failed = append(failed, i)
+		}
+	}
+
+	for _, part := range []struct {
+		indexes []int
+		keep    int
+		reason  string
+	}{
+		{succeeded, keep, "within keep_releases"},
+		{failed, p.config.KeepFailedReleases, "within keep_failed_releases"},
+	} {
+		subset := make([]images.Image, len(part.indexes))
+		for j, i := range part.indexes {
+			subset[j] = imageList[i]
+		}
+		selected := make([][]string, len(subset))
+		p.selectNewest(subset, selected, part.keep)
+		for j, i := range part.indexes {
+			if len(selected[j]) > 0 {
+				reasons[i] = append(reasons[i], part.reason)
 			}
+		}
+	}
+}
+
+// selectPerGroup selects the newest image of each value of
+// group_by_property, such as a git SHA. With global_max_keep, only the
+// newest values are kept.
+func (p *OpenStackPostProcessor) selectPerGroup(imageList []images.Image, reasons [][]string) {
+	property, max := p.config.GroupByProperty, p.config.GlobalMaxKeep
+	seen := make(map[string]bool)
+	for i, img := range imageList {
+		v, _ := p.property(img, property)
+		if seen[v] {
 			continue
 		}
+		seen[v] = true
+		if max > 0 && len(seen) > max {
+			continue
+		}
+		reasons[i] = append(reasons[i], fmt.Sprintf("newest image with %s %s", property, v))
+	}
+}
 
-		ui.Message(fmt.Sprintf("Deleting duplicating image: %s %s", img.Name, img.ID))
-		log.Printf("Deleting duplicating image (%s) (%s)", img.Name, img.ID)
-		if result := images.Delete(p.conn, img.ID); result.Err != nil {
-			return nil, true, false, result.Err
+// selectUntilSuperseded selects every image that has fewer than count newer
+// active images. Newer images that are not active, such as failed builds
+// stuck in saving, do not supersede anything.
+func selectUntilSuperseded(imageList []images.Image, reasons [][]string, count int) {
+	newerActive := 0
+	for i, img := range imageList {
+		if newerActive < count {
+			reasons[i] = append(reasons[i], "within keep_until_superseded")
+		}
+		if img.Status == images.ImageStatusActive {
+			newerActive++
 		}
 	}
+}
 
-	return artifact, true, false, nil
+// selectWeekly selects the newest image of each of the last weeks ISO weeks.
+func selectWeekly(imageList []images.Image, reasons [][]string, weeks int, now time.Time) {
+	wanted := make(map[[2]int]bool)
+	for k := 0; k < weeks; k++ {
+		year, week := now.AddDate(0, 0, -7*k).ISOWeek()
+		wanted[[2]int{year, week}] = true
+	}
+
+	for i, img := range imageList {
+		year, week := imageCreatedAt(img).ISOWeek()
+		key := [2]int{year, week}
+		if wanted[key] {
+			// The list is sorted newest first, so this is the newest image of the week.
+			reasons[i] = append(reasons[i], "within keep_weekly")
+			delete(wanted, key)
+		}
+	}
 }
 
 func (p *OpenStackPostProcessor) imageV2Client() (*gophercloud.ServiceClient, error) {
@@ -137,6 +1795,7 @@ func (p *OpenStackPostProcessor) imageV2Client() (*gophercloud.ServiceClient, er
 	if err != nil {
 		return nil, err
 	}
+	client.UseTokenLock()
 
 	tlsConfig := &tls.Config{}
 
@@ -146,7 +1805,9 @@ func (p *OpenStackPostProcessor) imageV2Client() (*gophercloud.ServiceClient, er
 			return nil, err
 		}
 		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no PEM certificates found in CA file %s", p.config.CACertFile)
+		}
 		tlsConfig.RootCAs = caCertPool
 	}
 
@@ -170,8 +1831,122 @@ func (p *OpenStackPostProcessor) imageV2Client() (*gophercloud.ServiceClient, er
 	if err = gopenstack.Authenticate(client, opts); err != nil {
 		return nil, err
 	}
+	p.setReauthFunc(client)
+
+	if len(p.config.ImageEndpoints) > 0 {
+		return firstResponsiveImageClient(client, p.config.ImageEndpoints)
+	}
 
 	return gopenstack.NewImageServiceV2(client, gophercloud.EndpointOpts{
 		Region: p.config.Region,
 	})
 }
+
+// reauthJitter is the maximum random delay before reauthenticating after a
+// rejected token, so that concurrent runs sharing credentials do not all
+// reauthenticate at the same moment.
+var reauthJitter = 5 * time.Second
+
+// withReauth runs op and, if it fails because the token was rejected even
+// after gophercloud's own reauthentication, reauthenticates once more after a
+// random delay and retries op once. Concurrent callers share a single
+// reauthentication.
+func (p *OpenStackPostProcessor) withReauth(op func() error) error {
+	err := op()
+	if !isUnauthorized(err) {
+		return err
+	}
+
+	token := p.conn.ProviderClient.Token()
+	delay := time.Duration(rand.Int63n(int64(reauthJitter) + 1))
+	log.Printf("Token rejected, reauthenticating in %s: %s", delay, err)
+	time.Sleep(delay)
+
+	if err := p.conn.ProviderClient.Reauthenticate(token); err != nil {
+		return fmt.Errorf("failed to reauthenticate: %s", err)
+	}
+	return op()
+}
+
+// isUnauthorized reports whether err is a 401, before or after gophercloud
+// tried to reauthenticate.
+func isUnauthorized(err error) bool {
+	switch e := err.(type) {
+	case gophercloud.ErrDefault401, *gophercloud.ErrUnableToReauthenticate:
+		return true
+	case *gophercloud.ErrErrorAfterReauthentication:
+		if original, ok := e.ErrOriginal.(*gophercloud.ErrUnexpectedResponseCode); ok {
+			return original.Actual == http.StatusUnauthorized
+		}
+		return isUnauthorized(e.ErrOriginal)
+	}
+	return false
+}
+
+// setReauthFunc makes the client reauthenticate with the reauth_*
+// credentials instead of the initial ones, if any are configured.
+func (p *OpenStackPostProcessor) setReauthFunc(client *gophercloud.ProviderClient) {
+	opts := gophercloud.AuthOptions{
+		IdentityEndpoint: p.config.IdentityEndpoint,
+		TenantID:         p.config.TenantID,
+		TenantName:       p.config.TenantName,
+		DomainID:         p.config.DomainID,
+		DomainName:       p.config.DomainName,
+	}
+	switch {
+	case p.config.ReauthApplicationCredentialID != "":
+		// Application credentials carry their own project scope.
+		opts = gophercloud.AuthOptions{
+			IdentityEndpoint:            p.config.IdentityEndpoint,
+			ApplicationCredentialID:     p.config.ReauthApplicationCredentialID,
+			ApplicationCredentialSecret: p.config.ReauthApplicationCredentialSecret,
+		}
+	case p.config.ReauthToken != "":
+		opts.TokenID = p.config.ReauthToken
+	default:
+		return
+	}
+
+	client.ReauthFunc = func() error {
+		log.Println("Reauthenticating with the reauth credentials")
+		refreshed, err := gopenstack.NewClient(opts.IdentityEndpoint)
+		if err != nil {
+			return err
+		}
+		refreshed.HTTPClient = client.HTTPClient
+
+		if err := gopenstack.Authenticate(refreshed, opts); err != nil {
+			return err
+		}
+		client.CopyTokenFrom(refreshed)
+		return nil
+	}
+}
+
+// firstResponsiveImageClient returns an image service client for the first
+// endpoint that answers a single-image list request.
+func firstResponsiveImageClient(client *gophercloud.ProviderClient, endpoints []string) (*gophercloud.ServiceClient, error) {
+	var errs *packer.MultiError
+	for _, endpoint := range endpoints {
+		sc := &gophercloud.ServiceClient{
+			ProviderClient: client,
+			Endpoint:       gophercloud.NormalizeURL(endpoint),
+			Type:           "image",
+		}
+		sc.ResourceBase = sc.Endpoint + "v2/"
+
+		log.Printf("Checking image endpoint %s", sc.Endpoint)
+		err := images.List(sc, images.ListOpts{Limit: 1}).EachPage(func(page pagination.Page) (bool, error) {
+			return false, nil
+		})
+		if err == nil {
+			log.Printf("Using image endpoint %s", sc.Endpoint)
+			return sc, nil
+		}
+
+		log.Printf("Image endpoint %s is not responsive: %s", sc.Endpoint, err)
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("%s: %s", sc.Endpoint, err))
+	}
+
+	return nil, fmt.Errorf("no responsive image endpoint: %s", errs)
+}
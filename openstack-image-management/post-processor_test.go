@@ -3,14 +3,23 @@ package openstackimagemanagement
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	th "github.com/gophercloud/gophercloud/testhelper"
 	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/builder/openstack"
 	"github.com/hashicorp/packer/packer"
 )
 
@@ -53,7 +62,8 @@ var imgs = []imageEntry{
 				"schema": "/v2/schemas/image",
 				"hw_disk_bus": "scsi",
 				"hw_disk_bus_model": "virtio-scsi",
-				"hw_scsi_model": "virtio-scsi"
+				"hw_scsi_model": "virtio-scsi",
+				"signature_verified": "False"
 			}`,
 	},
 	{
@@ -80,7 +90,8 @@ var imgs = []imageEntry{
 				"schema": "/v2/schemas/image",
 				"hw_disk_bus": "scsi",
 				"hw_disk_bus_model": "virtio-scsi",
-				"hw_scsi_model": "virtio-scsi"
+				"hw_scsi_model": "virtio-scsi",
+				"signature_verified": "False"
 			}`,
 	},
 	{
@@ -107,7 +118,8 @@ var imgs = []imageEntry{
 				"schema": "/v2/schemas/image",
 				"hw_disk_bus": "scsi",
 				"hw_disk_bus_model": "virtio-scsi",
-				"hw_scsi_model": "virtio-scsi"
+				"hw_scsi_model": "virtio-scsi",
+				"signature_verified": "False"
 			}`,
 	},
 	{
@@ -166,6 +178,94 @@ var imgs = []imageEntry{
 	},
 }
 
+// testIdentityServer fakes the Keystone token creation done by Configure.
+func testIdentityServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		if r.URL.Path != "/v3/auth/tokens" {
+			t.Errorf("Unexpected identity request: %s", r.URL.Path)
+		}
+
+		w.Header().Add("X-Subject-Token", fakeclient.TokenID)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"token": {"expires_at": "2099-01-01T00:00:00.000000Z", "catalog": []}}`)
+	}))
+}
+
+func testConfig(identity *httptest.Server) map[string]interface{} {
+	return map[string]interface{}{
+		"identity_endpoint": identity.URL + "/v3",
+		"username":          "admin",
+		"password":          "secret",
+		"domain_name":       "Default",
+		"identifier":        "packer-example",
+	}
+}
+
+func TestPostProcessorConfigurePolicyJSONEnv(t *testing.T) {
+	os.Setenv("TEST_RETENTION_POLICY", `{"keep_releases": 10, "keep_weekly": 4}`)
+	defer os.Unsetenv("TEST_RETENTION_POLICY")
+
+	identity := testIdentityServer(t)
+	defer identity.Close()
+
+	raw := testConfig(identity)
+	raw["policy_json_env"] = "TEST_RETENTION_POLICY"
+	raw["keep_weekly"] = 2
+
+	var p OpenStackPostProcessor
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.KeepReleases != 10 {
+		t.Fatalf("keep_releases should come from the policy: %d", p.config.KeepReleases)
+	}
+	if p.config.KeepWeekly != 2 {
+		t.Fatalf("keep_weekly should come from the template: %d", p.config.KeepWeekly)
+	}
+	if p.config.Username != "admin" {
+		t.Fatalf("unexpected username: %s", p.config.Username)
+	}
+}
+
+func TestPostProcessorConfigurePolicyJSONEnvGrouping(t *testing.T) {
+	os.Setenv("TEST_RETENTION_POLICY", `{"group_by_property": "os_distro", "global_max_keep": 5}`)
+	defer os.Unsetenv("TEST_RETENTION_POLICY")
+
+	identity := testIdentityServer(t)
+	defer identity.Close()
+
+	raw := testConfig(identity)
+	raw["policy_json_env"] = "TEST_RETENTION_POLICY"
+
+	var p OpenStackPostProcessor
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.config.GroupByProperty != "os_distro" || p.config.GlobalMaxKeep != 5 {
+		t.Fatalf("grouping should come from the policy: %q %d", p.config.GroupByProperty, p.config.GlobalMaxKeep)
+	}
+}
+
+func TestPostProcessorConfigurePolicyJSONEnvRejectsAuth(t *testing.T) {
+	os.Setenv("TEST_RETENTION_POLICY", `{"password": "other"}`)
+	defer os.Unsetenv("TEST_RETENTION_POLICY")
+
+	identity := testIdentityServer(t)
+	defer identity.Close()
+
+	raw := testConfig(identity)
+	raw["policy_json_env"] = "TEST_RETENTION_POLICY"
+
+	var p OpenStackPostProcessor
+	if err := p.Configure(raw); err == nil {
+		t.Fatal("should reject non retention settings")
+	}
+}
+
 func TestPostProcessorEmptyImages(t *testing.T) {
 	th.SetupHTTP()
 	defer th.TeardownHTTP()
@@ -191,6 +291,31 @@ func TestPostProcessorEmptyImages(t *testing.T) {
 	}
 }
 
+func TestPostProcessorEmptyListVisibleCheck(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-missing"
+	p.config.KeepReleases = 3
+	p.config.EmptyListVisibleCheck = true
+	ui := testUI()
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), ui, artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	out := ui.Writer.(*bytes.Buffer).String()
+	if !strings.Contains(out, `no images named "packer-missing" were found`) {
+		t.Fatalf("should warn about the empty list: %s", out)
+	}
+	if !strings.Contains(out, "Other images are visible") {
+		t.Fatalf("should report that other images are visible: %s", out)
+	}
+}
+
 func TestPostProcessorFewImages(t *testing.T) {
 	th.SetupHTTP()
 	defer th.TeardownHTTP()
@@ -220,7 +345,7 @@ func TestPostProcessorManyImages(t *testing.T) {
 	th.SetupHTTP()
 	defer th.TeardownHTTP()
 
-	ImageListHandler(t, imgs)
+	calls := ImageListHandler(t, imgs)
 
 	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
 	p.config.Identifier = "packer-example"
@@ -239,95 +364,1512 @@ func TestPostProcessorManyImages(t *testing.T) {
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
+
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+	}
 }
 
-func ImageListHandler(t *testing.T, images []imageEntry) {
-	th.Mux.HandleFunc("/images", func(w http.ResponseWriter, r *http.Request) {
-		th.TestMethod(t, r, "GET")
-		th.TestHeader(t, r, "X-Auth-Token", fakeclient.TokenID)
+func TestPostProcessorKeepReleasesByIdentifier(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
 
-		w.Header().Add("Content-Type", "application/json")
+	calls := ImageListHandler(t, imgs)
 
-		w.WriteHeader(http.StatusOK)
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifiers = []string{"packer-example", "cirros-0.3.4-x86_64-uec-kernel"}
+	p.config.KeepReleases = 1
+	p.config.KeepReleasesByIdentifier = map[string]int{"packer-example": 2}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		limit := 10
-		var err error
-		if r.FormValue("limit") != "" {
-			limit, err = strconv.Atoi(r.FormValue("limit"))
-			if err != nil {
-				t.Errorf("Error value for 'limit' parameter %v (error: %v)", r.FormValue("limit"), err)
-			}
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorPrefixes(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Prefixes = []string{"cirros-", "packer-"}
+	p.config.KeepReleases = 1
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sort.Strings(calls.Deleted)
+	expected := []string{
+		"8c64f48a-45a3-4eaa-adff-a8106b6c005b",
+		"e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4",
+		"e1b6edd4-bd9b-40ac-b010-8a6c16de4ba5",
+	}
+	if strings.Join(calls.Deleted, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+	}
+}
 
+func TestFamily(t *testing.T) {
+	var p OpenStackPostProcessor
+	p.config.Identifier = "svc-a-base"
+	p.config.Prefixes = []string{"svc-a-", "svc-"}
+
+	cases := map[string]string{
+		"svc-a-base":  "svc-a-base",
+		"svc-a-web":   "svc-a-",
+		"svc-b-web":   "svc-",
+		"other-image": "",
+	}
+	for name, expected := range cases {
+		if actual := p.family(images.Image{Name: name}); actual != expected {
+			t.Errorf("family(%s) = %q, expected %q", name, actual, expected)
 		}
+	}
+}
 
-		marker := ""
-		newMarker := ""
+func TestPartitionImagesMultiMatchPolicy(t *testing.T) {
+	imageList := []images.Image{
+		{ID: "a1", Name: "svc-a-1"},
+		{ID: "a2", Name: "svc-a-2"},
+		{ID: "b1", Name: "svc-b-1"},
+		{ID: "a3", Name: "svc-a-3"},
+		{ID: "b2", Name: "svc-b-2"},
+	}
 
-		if r.Form["marker"] != nil {
-			marker = r.Form["marker"][0]
+	cases := []struct {
+		policy  string
+		kept    string
+		expired string
+	}{
+		{multiMatchFirst, "a1,b1,b2", "a2,a3"},
+		{multiMatchAll, "a1,a2", "b1,a3,b2"},
+	}
+	for _, c := range cases {
+		var p OpenStackPostProcessor
+		p.config.Prefixes = []string{"svc-a-", "svc-"}
+		p.config.KeepReleasesByIdentifier = map[string]int{"svc-a-": 1, "svc-": 2}
+		p.config.MultiMatchPolicy = c.policy
+		kept, expired, _ := p.partitionImages(imageList, time.Now())
+
+		if ids := imageIDs(kept); strings.Join(ids, ",") != c.kept {
+			t.Errorf("%s: unexpected kept images: %v", c.policy, ids)
+		}
+		if ids := imageIDs(expired); strings.Join(ids, ",") != c.expired {
+			t.Errorf("%s: unexpected expired images: %v", c.policy, ids)
 		}
+	}
+}
 
-		t.Logf("limit = %v   marker = %v", limit, marker)
+func TestPostProcessorMultiMatchPolicyError(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
 
-		selected := 0
-		addNext := false
-		var imageJSON []string
+	calls := ImageListHandler(t, imgs)
 
-		fmt.Fprintf(w, `{"images": [`)
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Prefixes = []string{"packer-", "packer-ex"}
+	p.config.KeepReleases = 1
+	p.config.MultiMatchPolicy = multiMatchError
+	_, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{})
+	if err == nil || !strings.Contains(err.Error(), "matches several families (packer-, packer-ex)") {
+		t.Fatalf("should fail on ambiguous images: %v", err)
+	}
+	if len(calls.Deleted) != 0 {
+		t.Fatalf("should not delete anything: %v", calls.Deleted)
+	}
+}
 
-		for _, i := range images {
-			if marker == "" || addNext {
-				t.Logf("Adding image %v to page", i.ID)
-				imageJSON = append(imageJSON, i.JSON)
-				newMarker = i.ID
-				selected++
-			} else {
-				if strings.Contains(i.JSON, marker) {
-					addNext = true
-				}
-			}
+func TestPostProcessorConfigureKeepReleasesByIdentifier(t *testing.T) {
+	identity := testIdentityServer(t)
+	defer identity.Close()
 
-			if selected == limit {
-				break
-			}
+	raw := testConfig(identity)
+	raw["identifiers"] = []string{"packer-other"}
+	raw["keep_releases_by_identifier"] = map[string]int{"packer-other": 3}
+
+	var p OpenStackPostProcessor
+	err := p.Configure(raw)
+	if err == nil || !strings.Contains(err.Error(), "identifier packer-example has no keep_releases_by_identifier entry") {
+		t.Fatalf("should require a count for every identifier: %v", err)
+	}
+
+	raw["keep_releases"] = 2
+	p = OpenStackPostProcessor{}
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.keepReleases("packer-example") != 2 || p.keepReleases("packer-other") != 3 {
+		t.Fatalf("unexpected keep counts: %d %d", p.keepReleases("packer-example"), p.keepReleases("packer-other"))
+	}
+}
+
+func TestPostProcessorOutsideMaintenanceWindow(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.window = &maintenanceWindow{}
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 0 {
+		t.Fatalf("should not delete outside of the maintenance window: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorCheckOnly(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 0
+	p.config.CheckOnly = true
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Updated) != 0 || len(calls.Deleted) != 0 {
+		t.Fatalf("should not touch any image: %v %v", calls.Updated, calls.Deleted)
+	}
+}
+
+func TestPostProcessorMetadataTargetIDs(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.MetadataTargetIDs = []string{"e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4"}
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Updated) != 1 || calls.Updated[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("unexpected updated images: %v", calls.Updated)
+	}
+	if len(calls.Deleted) != 0 {
+		t.Fatalf("should not delete any image: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorMaxDeletesPerRun(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 0
+	p.config.MaxDeletesPerRun = 1
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("should only delete the oldest image: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorNDJSONOutput(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "ndjson")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.MaxDeletesPerRun = 1
+	p.config.NDJSONOutput = true
+	p.config.NDJSONOutputFile = filepath.Join(dir, "actions.ndjson")
+	basic := testUI()
+	ui := &packer.TargetedUI{Target: "openstack-image-management", Ui: basic}
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), ui, artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(p.config.NDJSONOutputFile)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		var action imageAction
+		if err := json.Unmarshal([]byte(line), &action); err != nil {
+			t.Fatalf("line is not JSON: %q: %s", line, err)
 		}
-		t.Logf("Writing out %v image(s)", len(imageJSON))
-		fmt.Fprintln(w, strings.Join(imageJSON, ","))
+		if action.CreatedAt == "" || action.Age == "" {
+			t.Fatalf("missing creation time or age: %s", line)
+		}
+		actions = append(actions, action.Action+":"+action.ID)
+	}
 
-		fmt.Fprintf(w, `],
-			    "next": "/images?marker=%s&limit=%v",
-			    "schema": "/schemas/images",
-			    "first": "/images?limit=%v"}`, newMarker, limit, limit)
+	expected := []string{
+		"keep:07aa21a9-fa1a-430e-9a33-185be5982431",
+		"skip:8c64f48a-45a3-4eaa-adff-a8106b6c005b",
+		"delete:e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4",
+	}
+	if strings.Join(actions, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected actions: %v", actions)
+	}
+	if out := basic.Writer.(*bytes.Buffer).String(); strings.Contains(out, `"action"`) {
+		t.Fatalf("actions should not be written to the UI:\n%s", out)
+	}
+}
 
-	})
-	th.Mux.HandleFunc("/images/07aa21a9-fa1a-430e-9a33-185be5982431", func(w http.ResponseWriter, r *http.Request) {
-		th.TestMethod(t, r, "DELETE")
-		th.TestHeader(t, r, "X-Auth-Token", fakeclient.TokenID)
+func TestPostProcessorConfigureNDJSONOutputRequiresFile(t *testing.T) {
+	identity := testIdentityServer(t)
+	defer identity.Close()
 
-		w.WriteHeader(http.StatusNoContent)
-	})
-	th.Mux.HandleFunc("/images/8c64f48a-45a3-4eaa-adff-a8106b6c005b", func(w http.ResponseWriter, r *http.Request) {
-		th.TestMethod(t, r, "DELETE")
-		th.TestHeader(t, r, "X-Auth-Token", fakeclient.TokenID)
+	raw := testConfig(identity)
+	raw["ndjson_output"] = true
 
-		w.WriteHeader(http.StatusNoContent)
-	})
-	th.Mux.HandleFunc("/images/e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4", func(w http.ResponseWriter, r *http.Request) {
-		th.TestMethod(t, r, "DELETE")
-		th.TestHeader(t, r, "X-Auth-Token", fakeclient.TokenID)
+	var p OpenStackPostProcessor
+	if err := p.Configure(raw); err == nil || !strings.Contains(err.Error(), "ndjson_output and ndjson_output_file must be set together") {
+		t.Fatalf("should reject ndjson_output without ndjson_output_file: %v", err)
+	}
+}
 
-		w.WriteHeader(http.StatusNoContent)
-	})
-	th.Mux.HandleFunc("/images/e1b6edd4-bd9b-40ac-b010-8a6c16de4ba5", func(w http.ResponseWriter, r *http.Request) {
-		th.TestMethod(t, r, "DELETE")
-		th.TestHeader(t, r, "X-Auth-Token", fakeclient.TokenID)
+func TestPostProcessorKeepsImagesNotOlderThanArtifact(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
 
-		w.WriteHeader(http.StatusNoContent)
-	})
-	th.Mux.HandleFunc("/images/8c64f48a-45a3-4eaa-adff-a8106b6c005v", func(w http.ResponseWriter, r *http.Request) {
-		th.TestMethod(t, r, "DELETE")
-		th.TestHeader(t, r, "X-Auth-Token", fakeclient.TokenID)
+	calls := ImageListHandler(t, imgs)
 
-		w.WriteHeader(http.StatusNoContent)
-	})
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 0
+	artifact := &packer.MockArtifact{
+		BuilderIdValue: openstack.BuilderId,
+		IdValue:        "8c64f48a-45a3-4eaa-adff-a8106b6c005b",
+	}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("should only delete images older than the artifact: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorSkipIfPropertyEquals(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.SkipIfPropertyEquals = map[string]string{
+		"kernel_id": "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4",
+	}
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Updated) != 1 || calls.Updated[0] != "8c64f48a-45a3-4eaa-adff-a8106b6c005b" {
+		t.Fatalf("skipped image should not be updated: %v", calls.Updated)
+	}
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorExcludeIfPropertyTruthy(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	review := imgs[2]
+	review.JSON = strings.Replace(review.JSON, `"signature_verified": "False"`, `"signature_verified": "False", "review_required": "true"`, 1)
+	calls := ImageListHandler(t, []imageEntry{imgs[0], imgs[1], review})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.ExcludeIfPropertyTruthy = []string{"review_required"}
+	p.config.NDJSONOutput = true
+	out := new(bytes.Buffer)
+	p.ndjson = out
+	if _, _, _, err := p.postProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "8c64f48a-45a3-4eaa-adff-a8106b6c005b" {
+		t.Fatalf("image pending review should not be deleted: %v", calls.Deleted)
+	}
+	if out := out.String(); !strings.Contains(out, `"action":"skip","id":"e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4","name":"packer-example","reason":"pending review, property review_required is true"`) {
+		t.Fatalf("image pending review should be reported as skipped:\n%s", out)
+	}
+}
+
+func TestSkipReasonManageOnlyTeams(t *testing.T) {
+	var p OpenStackPostProcessor
+	p.config.ManageOnlyTeams = []string{"platform", "build"}
+
+	if reason := p.skipReason(images.Image{Properties: map[string]interface{}{"owner_team": "build"}}); reason != "" {
+		t.Fatalf("image of a managed team should not be skipped: %s", reason)
+	}
+	if reason := p.skipReason(images.Image{Properties: map[string]interface{}{"owner_team": "data"}}); reason != `owner_team "data" is not managed` {
+		t.Fatalf("unexpected reason: %q", reason)
+	}
+	if reason := p.skipReason(images.Image{}); reason == "" {
+		t.Fatal("image without owner_team should be skipped")
+	}
+}
+
+func TestPostProcessorCountOwnedOnly(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	shared := imgs[0]
+	shared.JSON = strings.Replace(shared.JSON, `"owner": "cba624273b8344e59dd1fd18685183b0"`, `"owner": "5a8d2d6f3dc44b4d8c3a5f0e2b6c8d9e"`, 1)
+	calls := ImageListHandler(t, []imageEntry{shared, imgs[1], imgs[2]})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.TenantID = "cba624273b8344e59dd1fd18685183b0"
+	p.config.CountOwnedOnly = true
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The shared-in newest image does not take the only keep slot.
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorCreatedAtFallback(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	// Without created_at, the image is ordered by updated_at, making it the newest.
+	legacy := imageEntry{
+		ID: "packer-example-legacy",
+		JSON: `{
+				"status": "active",
+				"name": "packer-example",
+				"tags": [],
+				"container_format": "bare",
+				"disk_format": "qcow2",
+				"updated_at": "2015-07-15T11:43:40Z",
+				"visibility": "private",
+				"self": "/v2/images/b7d3b0ce-f6a1-4b36-9b3a-ec4f1d6a49b2",
+				"min_disk": 0,
+				"protected": false,
+				"id": "b7d3b0ce-f6a1-4b36-9b3a-ec4f1d6a49b2",
+				"file": "/v2/images/b7d3b0ce-f6a1-4b36-9b3a-ec4f1d6a49b2/file",
+				"owner": "cba624273b8344e59dd1fd18685183b0",
+				"min_ram": 0,
+				"schema": "/v2/schemas/image",
+				"signature_verified": "False"
+			}`,
+	}
+	calls := ImageListHandler(t, append([]imageEntry{legacy}, imgs...))
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 2
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Join(calls.Updated, ",") != "b7d3b0ce-f6a1-4b36-9b3a-ec4f1d6a49b2,07aa21a9-fa1a-430e-9a33-185be5982431" {
+		t.Fatalf("unexpected kept images: %v", calls.Updated)
+	}
+	if strings.Join(calls.Deleted, ",") != "8c64f48a-45a3-4eaa-adff-a8106b6c005b,e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorFailOnSkips(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	protected := imgs[1]
+	protected.JSON = strings.Replace(protected.JSON, `"protected": false`, `"protected": true`, 1)
+	calls := ImageListHandler(t, []imageEntry{imgs[0], protected, imgs[2]})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 0
+	p.config.FailOnSkips = true
+	ui := testUI()
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), ui, artifact); err == nil {
+		t.Fatal("should fail when images are skipped")
+	}
+
+	if len(calls.Deleted) != 2 {
+		t.Fatalf("should complete the other deletions: %v", calls.Deleted)
+	}
+	if out := ui.Writer.(*bytes.Buffer).String(); !strings.Contains(out, "Run aborted: 2 image(s) deleted, 0 kept and 1 skipped so far") {
+		t.Fatalf("missing partial summary:\n%s", out)
+	}
+}
+
+func TestPostProcessorFailOnSkipsIgnoresPostponedDeletions(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 0
+	p.config.MaxDeletesPerRun = 2
+	p.config.FailOnSkips = true
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("images left to max_deletes_per_run should not fail the run: %s", err)
+	}
+	if len(calls.Deleted) != 2 {
+		t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+	}
+
+	p.config.MaxDeletesPerRun = 0
+	p.config.window = &maintenanceWindow{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("images outside the maintenance window should not fail the run: %s", err)
+	}
+}
+
+func TestPostProcessorSummarizesAbortedRun(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.TerraformOutput = filepath.Join("does-not-exist", "images.tf")
+	ui := testUI()
+	if _, _, _, err := p.PostProcess(context.Background(), ui, &packer.MockArtifact{}); err == nil {
+		t.Fatal("should fail to write the Terraform output")
+	}
+
+	if out := ui.Writer.(*bytes.Buffer).String(); !strings.Contains(out, "Run aborted: 2 image(s) deleted, 1 kept and 0 skipped so far") {
+		t.Fatalf("missing partial summary:\n%s", out)
+	}
+}
+
+func TestFirstResponsiveImageClient(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	th.Mux.HandleFunc("/v2/images", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		th.TestFormValues(t, r, map[string]string{"limit": "1"})
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"images": []}`)
+	})
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	client := fakeclient.ServiceClient().ProviderClient
+	sc, err := firstResponsiveImageClient(client, []string{down.URL, th.Endpoint()})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if sc.ResourceBase != th.Endpoint()+"v2/" {
+		t.Fatalf("unexpected resource base: %s", sc.ResourceBase)
+	}
+
+	if _, err := firstResponsiveImageClient(client, []string{down.URL}); err == nil {
+		t.Fatal("should fail without a responsive endpoint")
+	}
+}
+
+func TestImageV2ClientInvalidCACertFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "cacert")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not a certificate")
+	f.Close()
+
+	var p OpenStackPostProcessor
+	p.config.IdentityEndpoint = "http://127.0.0.1:5000/v3"
+	p.config.CACertFile = f.Name()
+	_, err = p.imageV2Client()
+	if err == nil || !strings.Contains(err.Error(), "no PEM certificates found in CA file "+f.Name()) {
+		t.Fatalf("should reject the CA file: %v", err)
+	}
+}
+
+func TestWithReauthMidRun401(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	defer func(jitter time.Duration) { reauthJitter = jitter }(reauthJitter)
+	reauthJitter = 0
+
+	// The token expires mid-run, and the first reauthentication is not
+	// accepted yet, as during a burst of reauthentications.
+	requests := 0
+	th.Mux.HandleFunc("/images/e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "DELETE")
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	reauths := 0
+	p.conn.ProviderClient.ReauthFunc = func() error {
+		reauths++
+		p.conn.ProviderClient.SetToken(fmt.Sprintf("token-%d", reauths))
+		return nil
+	}
+
+	err := p.withReauth(func() error {
+		return images.Delete(p.conn, "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4").Err
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if requests != 3 || reauths != 2 {
+		t.Fatalf("unexpected requests and reauthentications: %d %d", requests, reauths)
+	}
+}
+
+func TestSetReauthFunc(t *testing.T) {
+	var methods []string
+	identity := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+
+		var body struct {
+			Auth struct {
+				Identity struct {
+					Methods []string `json:"methods"`
+				} `json:"identity"`
+			} `json:"auth"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("err: %s", err)
+		}
+		methods = append(methods, body.Auth.Identity.Methods...)
+
+		w.Header().Add("X-Subject-Token", "refreshed")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"token": {"expires_at": "2099-01-01T00:00:00.000000Z", "catalog": []}}`)
+	}))
+	defer identity.Close()
+
+	p := OpenStackPostProcessor{}
+	p.config.IdentityEndpoint = identity.URL + "/v3"
+	p.config.ReauthApplicationCredentialID = "refresh"
+	p.config.ReauthApplicationCredentialSecret = "secret"
+
+	client := fakeclient.ServiceClient().ProviderClient
+	p.setReauthFunc(client)
+	if err := client.Reauthenticate(client.Token()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Join(methods, ",") != "application_credential" {
+		t.Fatalf("should reauthenticate with the application credential: %v", methods)
+	}
+	if client.Token() != "refreshed" {
+		t.Fatalf("unexpected token: %s", client.Token())
+	}
+}
+
+func TestPartitionImagesPreferDistinctChecksums(t *testing.T) {
+	imageList := []images.Image{
+		{ID: "a", Checksum: "1"},
+		{ID: "b", Checksum: "1"},
+		{ID: "c", Checksum: "2"},
+		{ID: "d", Checksum: "3"},
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepReleases = 3
+	p.config.PreferDistinctChecksums = true
+	kept, expired, _ := p.partitionImages(imageList, time.Now())
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "a,c,d" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "b" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+
+	p.config.KeepReleases = 4
+	kept, expired, _ = p.partitionImages(imageList, time.Now())
+	if len(kept) != 4 || len(expired) != 0 {
+		t.Fatalf("duplicates should fill the remaining slots: %v %v", imageIDs(kept), imageIDs(expired))
+	}
+}
+
+type imageCalls struct {
+	Updated []string
+	Deleted []string
+}
+
+func TestPartitionImagesKeepWeekly(t *testing.T) {
+	now := time.Date(2020, 8, 5, 12, 0, 0, 0, time.UTC) // Wednesday
+	imageList := []images.Image{
+		{ID: "a", CreatedAt: now.Add(-1 * time.Hour)},
+		{ID: "b", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "c", CreatedAt: now.AddDate(0, 0, -7)},
+		{ID: "d", CreatedAt: now.AddDate(0, 0, -8)},
+		{ID: "e", CreatedAt: now.AddDate(0, 0, -21)},
+		{ID: "f", CreatedAt: now.AddDate(0, 0, -35)},
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepReleases = 2
+	p.config.KeepWeekly = 4
+	kept, expired, reasons := p.partitionImages(imageList, now)
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "a,b,c,e" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "d,f" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+
+	expected := map[string]string{
+		"a": "within keep_releases, within keep_weekly",
+		"b": "within keep_releases",
+		"c": "within keep_weekly",
+		"e": "within keep_weekly",
+	}
+	for id, reason := range expected {
+		if actual := strings.Join(reasons[id], ", "); actual != reason {
+			t.Errorf("unexpected keep reasons of %s: %q", id, actual)
+		}
+	}
+}
+
+func TestPartitionImagesKeepUntilSuperseded(t *testing.T) {
+	imageList := []images.Image{
+		{ID: "a", Status: images.ImageStatusSaving},
+		{ID: "b", Status: images.ImageStatusActive},
+		{ID: "c", Status: images.ImageStatusKilled},
+		{ID: "d", Status: images.ImageStatusActive},
+		{ID: "e", Status: images.ImageStatusActive},
+		{ID: "f", Status: images.ImageStatusActive},
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepUntilSuperseded = 2
+	kept, expired, _ := p.partitionImages(imageList, time.Now())
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "a,b,c,d" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "e,f" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+}
+
+func TestPostProcessorRemoveProperties(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "cirros-0.3.4-x86_64-uec-kernel"
+	p.config.KeepReleases = 1
+	p.config.RemoveProperties = []string{"signature_verified", "status"}
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Updated) != 0 {
+		t.Fatalf("should not update an image without the properties: %v", calls.Updated)
+	}
+}
+
+func TestPostProcessorConfigureReservedRemoveProperties(t *testing.T) {
+	identity := testIdentityServer(t)
+	defer identity.Close()
+
+	raw := testConfig(identity)
+	raw["remove_properties"] = []string{"signature_verified", "checksum"}
+
+	var p OpenStackPostProcessor
+	err := p.Configure(raw)
+	if err == nil || !strings.Contains(err.Error(), "checksum is a reserved image attribute") {
+		t.Fatalf("should reject reserved attributes: %v", err)
+	}
+}
+
+func TestPostProcessorConfigureAllowedRegions(t *testing.T) {
+	identity := testIdentityServer(t)
+	defer identity.Close()
+
+	raw := testConfig(identity)
+	raw["regions"] = []string{"RegionOne", "RegoinTwo"}
+	raw["allowed_regions"] = []string{"RegionOne", "RegionTwo"}
+
+	var p OpenStackPostProcessor
+	err := p.Configure(raw)
+	if err == nil || !strings.Contains(err.Error(), "region RegoinTwo is not in allowed_regions") {
+		t.Fatalf("should reject regions not in allowed_regions: %v", err)
+	}
+
+	raw["regions"] = []string{"RegionOne", "RegionTwo"}
+	p = OpenStackPostProcessor{}
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestPostProcessorRegions(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "regions")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	identity := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Subject-Token", fakeclient.TokenID)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"expires_at": "2099-01-01T00:00:00.000000Z", "catalog": [{"type": "image", "endpoints": [
+			{"interface": "public", "region": "RegionOne", "url": %[1]q},
+			{"interface": "public", "region": "RegionTwo", "url": %[1]q}
+		]}]}}`, th.Endpoint())
+	}))
+	defer identity.Close()
+
+	// Both regions share the fake image service, which lists the images
+	// without the version prefix.
+	th.Mux.Handle("/v2/", http.StripPrefix("/v2", th.Mux))
+	calls := ImageListHandler(t, imgs)
+
+	raw := testConfig(identity)
+	raw["keep_releases"] = 2
+	raw["regions"] = []string{"RegionOne", "RegionTwo"}
+	raw["report_output"] = filepath.Join(dir, "report.json")
+	raw["terraform_output"] = filepath.Join(dir, "images.tf.json")
+
+	var p OpenStackPostProcessor
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Join(calls.Deleted, ",") != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4,e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("should delete in each region: %v", calls.Deleted)
+	}
+	for _, region := range []string{"RegionOne", "RegionTwo"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "report."+region+".json"))
+		if err != nil {
+			t.Fatalf("missing report of %s: %s", region, err)
+		}
+		var r report
+		if err := json.Unmarshal(b, &r); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if r.Kept != 2 || r.Deleted != 1 {
+			t.Fatalf("unexpected report of %s: %s", region, b)
+		}
+
+		b, err = ioutil.ReadFile(filepath.Join(dir, "images."+region+".tf.json"))
+		if err != nil {
+			t.Fatalf("missing Terraform output of %s: %s", region, err)
+		}
+		var imports map[string][]terraformImport
+		if err := json.Unmarshal(b, &imports); err != nil {
+			t.Fatalf("Terraform output of %s should be JSON: %s", region, err)
+		}
+		if len(imports["import"]) != 2 {
+			t.Fatalf("unexpected Terraform output of %s: %s", region, b)
+		}
+	}
+	if p.config.Region != "" || p.config.ReportOutput != filepath.Join(dir, "report.json") {
+		t.Fatalf("configuration should be restored: %s %s", p.config.Region, p.config.ReportOutput)
+	}
+}
+
+func TestPostProcessorUpdateMetaWithin(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 3
+	p.config.UpdateMetaWithin = 24 * time.Hour
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Updated) != 0 {
+		t.Fatalf("should not update old images: %v", calls.Updated)
+	}
+}
+
+func TestPostProcessorMaxPages(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	// Every page links to another one.
+	pages := 0
+	th.Mux.HandleFunc("/images", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		if r.FormValue("sort_key") != "created_at" || r.FormValue("sort_dir") != "desc" {
+			t.Errorf("images should be listed newest first: %s", r.URL.RawQuery)
+		}
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"images": [%s], "next": "/images?marker=%s&sort_key=created_at&sort_dir=desc"}`, imgs[pages].JSON, imgs[pages].ID)
+		pages++
+	})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 5
+	p.config.RemoveProperties = []string{}
+	p.config.MaxPages = 3
+	ui := testUI()
+	if _, _, _, err := p.PostProcess(context.Background(), ui, &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if pages != 3 {
+		t.Fatalf("should stop after 3 pages, listed %d", pages)
+	}
+	if out := ui.Writer.(*bytes.Buffer).String(); !strings.Contains(out, "stopped listing images after max_pages (3) pages") {
+		t.Fatalf("should warn about the truncated listing:\n%s", out)
+	}
+}
+
+func TestPostProcessorProtectIfUpdatedWithin(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	touched := imgs[2]
+	touched.JSON = strings.Replace(touched.JSON, `"updated_at": "2015-07-15T11:43:30Z"`, fmt.Sprintf(`"updated_at": %q`, time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)), 1)
+	calls := ImageListHandler(t, []imageEntry{imgs[0], imgs[1], touched})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.ProtectIfUpdatedWithin = 48 * time.Hour
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 1 || calls.Deleted[0] != "8c64f48a-45a3-4eaa-adff-a8106b6c005b" {
+		t.Fatalf("recently updated image should be kept: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorAnchorNowToNewest(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 3
+	p.config.UpdateMetaWithin = 24 * time.Hour
+	p.config.AnchorNowToNewest = true
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Updated) != 3 {
+		t.Fatalf("images created within a day of the newest one should be updated: %v", calls.Updated)
+	}
+
+	now := p.retentionNow([]images.Image{{CreatedAt: time.Date(2020, 8, 5, 12, 0, 0, 0, time.UTC)}, {}})
+	if expected := time.Date(2020, 8, 5, 12, 1, 0, 0, time.UTC); !now.Equal(expected) {
+		t.Fatalf("unexpected now: %s", now)
+	}
+}
+
+func TestPostProcessorRequiredProperties(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.RequiredProperties = []string{"os_distro", "kernel_id", "build_id"}
+	_, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{})
+	if err == nil || !strings.Contains(err.Error(), "07aa21a9-fa1a-430e-9a33-185be5982431 lacks the required properties: os_distro, build_id") {
+		t.Fatalf("should fail on missing properties: %v", err)
+	}
+	if len(calls.Updated) != 0 || len(calls.Deleted) != 0 {
+		t.Fatalf("should not touch any image: %v %v", calls.Updated, calls.Deleted)
+	}
+}
+
+func TestPostProcessorStripProperties(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 2
+	p.config.UpdateMetaWithin = 24 * time.Hour
+	p.config.StripProperties = []string{"signature_verified"}
+	artifact := &packer.MockArtifact{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), artifact); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Join(calls.Updated, ",") != "07aa21a9-fa1a-430e-9a33-185be5982431,8c64f48a-45a3-4eaa-adff-a8106b6c005b" {
+		t.Fatalf("strip_properties should apply to every kept image: %v", calls.Updated)
+	}
+}
+
+func TestPartitionImagesManualDeleteProperty(t *testing.T) {
+	imageList := []images.Image{
+		{ID: "a", Properties: map[string]interface{}{"delete": "true"}},
+		{ID: "b"},
+		{ID: "c", Properties: map[string]interface{}{"delete": "no"}},
+		{ID: "d", Properties: map[string]interface{}{"delete": true}},
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepReleases = 1
+	p.config.KeepWeekly = 1
+	p.config.ManualDeleteProperty = "delete"
+	kept, expired, _ := p.partitionImages(imageList, time.Now())
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "b,c" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "a,d" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+}
+
+func TestPartitionImagesDedupeSameName(t *testing.T) {
+	imageList := []images.Image{
+		{ID: "a1", Name: "a"},
+		{ID: "b1", Name: "b"},
+		{ID: "a2", Name: "a"},
+		{ID: "a3", Name: "a"},
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepReleases = 3
+	p.config.DedupeSameName = true
+	kept, expired, _ := p.partitionImages(imageList, time.Now())
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "a1,b1" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "a2,a3" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+}
+
+func TestPartitionImagesGroupByProperty(t *testing.T) {
+	sha := func(id, sha string) images.Image {
+		return images.Image{ID: id, Properties: map[string]interface{}{"git_sha": sha}}
+	}
+	imageList := []images.Image{
+		sha("a", "c3"),
+		sha("b", "c3"),
+		sha("c", "c2"),
+		sha("d", "c1"),
+		sha("e", "c2"),
+		sha("f", "c0"),
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.GroupByProperty = "git_sha"
+	p.config.GlobalMaxKeep = 3
+	kept, expired, _ := p.partitionImages(imageList, time.Now())
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "a,c,d" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "b,e,f" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+}
+
+func TestPartitionImagesSuccessProperty(t *testing.T) {
+	build := func(id, result string) images.Image {
+		return images.Image{ID: id, Properties: map[string]interface{}{"build_result": result}}
+	}
+	imageList := []images.Image{
+		build("a", "failure"),
+		build("b", "success"),
+		build("c", "failure"),
+		build("d", "success"),
+		build("e", "success"),
+		{ID: "f"},
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepReleases = 2
+	p.config.SuccessProperty = "build_result"
+	p.config.SuccessValue = "success"
+	p.config.KeepFailedReleases = 1
+	kept, expired, reasons := p.partitionImages(imageList, time.Now())
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "a,b,d" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "c,e,f" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+	if r := strings.Join(reasons["a"], "; "); r != "within keep_failed_releases" {
+		t.Fatalf("unexpected reasons: %s", r)
+	}
+}
+
+func TestNamePattern(t *testing.T) {
+	imageList := []images.Image{
+		{ID: "a", Name: "app_prod_20240103_7"},
+		{ID: "b", Name: "app_prod_20240102_5"},
+		{ID: "c", Name: "app_prod_20240103_10"},
+		{ID: "d", Name: "app_dev_20240103_8"},
+		{ID: "e", Name: "app_prod_20240101_3"},
+		{ID: "f", Name: "unrelated"},
+	}
+
+	p := OpenStackPostProcessor{}
+	re, err := parseNamePattern(`^(?P<app>[a-z]+)_(?P<env>[a-z]+)_(?P<date>\d{8})_(?P<build>\d+)$`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	p.config.namePattern = re
+	p.config.SortBy = "property:build"
+	p.config.MatchProperties = map[string]string{"env": "prod"}
+	p.config.GroupByProperty = "date"
+	p.config.GlobalMaxKeep = 2
+
+	p.sortImages(imageList)
+	if ids := imageIDs(imageList); strings.Join(ids, ",") != "c,d,a,b,e,f" {
+		t.Fatalf("unexpected order: %v", ids)
+	}
+
+	var managed []images.Image
+	for _, img := range imageList {
+		if p.skipReason(img) == "" {
+			managed = append(managed, img)
+		}
+	}
+	kept, expired, _ := p.partitionImages(managed, time.Now())
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "c,b" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "a,e" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+
+	if _, err := parseNamePattern(`^app_\d+$`); err == nil {
+		t.Fatalf("should reject a name_pattern without named groups")
+	}
+}
+
+func TestPostProcessorSortByNewestKeptImage(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "sort")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var entries []imageEntry
+	for i, img := range imgs[:3] {
+		// The oldest image has the highest build.
+		img.JSON = strings.Replace(img.JSON, `"signature_verified": "False"`, fmt.Sprintf(`"signature_verified": "False", "build": "%d"`, i+1), 1)
+		entries = append(entries, img)
+	}
+	ImageListHandler(t, entries)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 3
+	p.config.SortBy = "property:build"
+	p.config.CIOutputFormat = ciOutputGitLab
+	p.config.CIOutputFile = filepath.Join(dir, "image-management.env")
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(p.config.CIOutputFile)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(string(b), "IMAGE_MANAGEMENT_NEWEST_IMAGE_ID=e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4\n") {
+		t.Fatalf("the newest kept image should follow sort_by:\n%s", b)
+	}
+}
+
+func TestPartitionImagesRules(t *testing.T) {
+	now := time.Date(2020, 8, 5, 12, 0, 0, 0, time.UTC)
+	channel := func(id, channel string, age time.Duration) images.Image {
+		img := images.Image{ID: id, CreatedAt: now.Add(-age)}
+		if channel != "" {
+			img.Properties = map[string]interface{}{"channel": channel}
+		}
+		return img
+	}
+	imageList := []images.Image{
+		channel("s1", "stable", time.Hour),
+		channel("e1", "edge", 2*time.Hour),
+		channel("o1", "", 3*time.Hour),
+		channel("e2", "edge", 4*time.Hour),
+		channel("s2", "stable", 5*time.Hour),
+		channel("o2", "", 6*time.Hour),
+		channel("s3", "stable", 50*time.Hour),
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepReleases = 1
+	p.config.Rules = []RetentionRule{
+		{Property: "channel", Value: "stable", KeepReleases: 20, MaxAge: 48 * time.Hour},
+		{Property: "channel", Value: "edge", KeepReleases: 1},
+	}
+	kept, expired, reasons := p.partitionImages(imageList, now)
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "s1,e1,o1,s2" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "e2,o2,s3" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+	if r := strings.Join(reasons["e1"], ", "); r != "within keep_releases of rule channel=edge" {
+		t.Fatalf("unexpected reasons: %s", r)
+	}
+}
+
+func TestPartitionImagesRuleMaxAgeOnly(t *testing.T) {
+	now := time.Date(2020, 8, 5, 12, 0, 0, 0, time.UTC)
+	imageList := []images.Image{
+		{ID: "n1", CreatedAt: now.Add(-time.Hour), Properties: map[string]interface{}{"channel": "nightly"}},
+		{ID: "n2", CreatedAt: now.Add(-20 * time.Hour), Properties: map[string]interface{}{"channel": "nightly"}},
+		{ID: "n3", CreatedAt: now.Add(-30 * time.Hour), Properties: map[string]interface{}{"channel": "nightly"}},
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepReleases = 1
+	p.config.Rules = []RetentionRule{{Property: "channel", Value: "nightly", MaxAge: 24 * time.Hour}}
+	kept, expired, reasons := p.partitionImages(imageList, now)
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "n1,n2" {
+		t.Fatalf("should keep every image within max_age: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "n3" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+	if r := strings.Join(reasons["n2"], ", "); r != "within max_age of rule channel=nightly" {
+		t.Fatalf("unexpected reasons: %s", r)
+	}
+}
+
+func TestPostProcessorConfigureRules(t *testing.T) {
+	identity := testIdentityServer(t)
+	defer identity.Close()
+
+	raw := testConfig(identity)
+	raw["rules"] = []map[string]interface{}{
+		{"property": "channel", "value": "stable", "keep_releases": 20, "max_age": "720h"},
+		{"value": "edge", "keep_releases": 3},
+	}
+
+	var p OpenStackPostProcessor
+	err := p.Configure(raw)
+	if err == nil || !strings.Contains(err.Error(), "rules[1]: property must be set") {
+		t.Fatalf("should reject a rule without property: %v", err)
+	}
+
+	raw["rules"] = raw["rules"].([]map[string]interface{})[:1]
+	raw["manual_delete_property"] = "delete"
+	p = OpenStackPostProcessor{}
+	err = p.Configure(raw)
+	if err == nil || !strings.Contains(err.Error(), "rules cannot be combined with manual_delete_property") {
+		t.Fatalf("should reject rules with manual_delete_property: %v", err)
+	}
+
+	delete(raw, "manual_delete_property")
+	p = OpenStackPostProcessor{}
+	if err := p.Configure(raw); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if rule := p.config.Rules[0]; rule.KeepReleases != 20 || rule.MaxAge != 720*time.Hour {
+		t.Fatalf("unexpected rule: %+v", rule)
+	}
+}
+
+func TestPartitionImagesManageSnapshots(t *testing.T) {
+	imageList := []images.Image{
+		{ID: "a1", Properties: map[string]interface{}{"instance_uuid": "a"}},
+		{ID: "b1", Properties: map[string]interface{}{"instance_uuid": "b"}},
+		{ID: "a2", Properties: map[string]interface{}{"instance_uuid": "a"}},
+		{ID: "a3", Properties: map[string]interface{}{"instance_uuid": "a"}},
+		{ID: "b2", Properties: map[string]interface{}{"instance_uuid": "b"}},
+		{ID: "b3", Properties: map[string]interface{}{"instance_uuid": "b"}},
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepReleases = 2
+	p.config.ManageSnapshots = true
+	p.config.SnapshotGroupProperty = "instance_uuid"
+	kept, expired, _ := p.partitionImages(imageList, time.Now())
+
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "a1,b1,a2,b2" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "a3,b3" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                             "0m",
+		42 * time.Minute:              "42m",
+		5*time.Hour + 12*time.Minute:  "5h12m",
+		76*time.Hour + 30*time.Minute: "3d4h",
+		-time.Minute:                  "0m",
+	}
+	for d, expected := range cases {
+		if actual := formatAge(d); actual != expected {
+			t.Errorf("formatAge(%s) = %q, expected %q", d, actual, expected)
+		}
+	}
+}
+
+func TestRequiredImages(t *testing.T) {
+	requires := func(id, required string) images.Image {
+		img := images.Image{ID: id, Properties: map[string]interface{}{}}
+		if required != "" {
+			img.Properties["requires_image_id"] = required
+		}
+		return img
+	}
+	kept := []images.Image{requires("a", "c"), requires("b", "")}
+	expired := []images.Image{requires("c", "e"), requires("d", "a"), requires("e", ""), requires("f", "")}
+
+	required, requiredBy := requiredImages(kept, expired, "requires_image_id")
+	if ids := imageIDs(required); strings.Join(ids, ",") != "c,e" {
+		t.Fatalf("unexpected required images: %v", ids)
+	}
+	if requiredBy["c"] != "a" || requiredBy["e"] != "c" {
+		t.Fatalf("unexpected requiring images: %v", requiredBy)
+	}
+}
+
+func TestOrderDeletions(t *testing.T) {
+	imageList := []images.Image{
+		{ID: "base"},
+		{ID: "unrelated"},
+		{ID: "child", Properties: map[string]interface{}{"base_image_id": "base"}},
+		{ID: "grandchild", Properties: map[string]interface{}{"base_image_id": "child"}},
+		{ID: "other", Properties: map[string]interface{}{"base_image_id": "missing"}},
+	}
+
+	ordered := orderDeletions(imageList, "base_image_id")
+	if ids := imageIDs(ordered); strings.Join(ids, ",") != "grandchild,child,base,unrelated,other" {
+		t.Fatalf("unexpected order: %v", ids)
+	}
+}
+
+func TestLimitDeletions(t *testing.T) {
+	// Newest first, the oldest image is the base of the two newest.
+	imageList := []images.Image{
+		{ID: "grandchild", Properties: map[string]interface{}{"base_image_id": "child"}},
+		{ID: "child", Properties: map[string]interface{}{"base_image_id": "base"}},
+		{ID: "unrelated"},
+		{ID: "base"},
+	}
+
+	limited, deferred := limitDeletions(imageList, 2, "base_image_id")
+	if ids := imageIDs(limited); strings.Join(ids, ",") != "grandchild,unrelated" {
+		t.Fatalf("should not delete a base image before its dependents: %v", ids)
+	}
+	if ids := imageIDs(deferred); strings.Join(ids, ",") != "child,base" {
+		t.Fatalf("unexpected deferred images: %v", ids)
+	}
+
+	limited, _ = limitDeletions(imageList, 3, "base_image_id")
+	if ids := imageIDs(orderDeletions(limited, "base_image_id")); strings.Join(ids, ",") != "grandchild,child,base" {
+		t.Fatalf("should delete the base image with its dependents: %v", ids)
+	}
+
+	limited, _ = limitDeletions(imageList, 2, "")
+	if ids := imageIDs(limited); strings.Join(ids, ",") != "unrelated,base" {
+		t.Fatalf("should delete the oldest images: %v", ids)
+	}
+}
+
+func ImageListHandler(t *testing.T, images []imageEntry) *imageCalls {
+	calls := &imageCalls{}
+
+	th.Mux.HandleFunc("/images", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		th.TestHeader(t, r, "X-Auth-Token", fakeclient.TokenID)
+
+		w.Header().Add("Content-Type", "application/json")
+
+		w.WriteHeader(http.StatusOK)
+
+		limit := 10
+		var err error
+		if r.FormValue("limit") != "" {
+			limit, err = strconv.Atoi(r.FormValue("limit"))
+			if err != nil {
+				t.Errorf("Error value for 'limit' parameter %v (error: %v)", r.FormValue("limit"), err)
+			}
+
+		}
+
+		marker := ""
+		newMarker := ""
+
+		if r.Form["marker"] != nil {
+			marker = r.Form["marker"][0]
+		}
+
+		t.Logf("limit = %v   marker = %v", limit, marker)
+
+		selected := 0
+		addNext := false
+		var imageJSON []string
+
+		fmt.Fprintf(w, `{"images": [`)
+
+		for _, i := range images {
+			if name := r.FormValue("name"); name != "" && imageName(t, i) != name {
+				continue
+			}
+
+			if marker == "" || addNext {
+				t.Logf("Adding image %v to page", i.ID)
+				imageJSON = append(imageJSON, i.JSON)
+				newMarker = i.ID
+				selected++
+			} else {
+				if strings.Contains(i.JSON, marker) {
+					addNext = true
+				}
+			}
+
+			if selected == limit {
+				break
+			}
+		}
+		t.Logf("Writing out %v image(s)", len(imageJSON))
+		fmt.Fprintln(w, strings.Join(imageJSON, ","))
+
+		fmt.Fprintf(w, `],
+			    "next": "/images?marker=%s&limit=%v",
+			    "schema": "/schemas/images",
+			    "first": "/images?limit=%v"}`, newMarker, limit, limit)
+
+	})
+	for _, i := range images {
+		id := imageID(t, i)
+		body := i.JSON
+		th.Mux.HandleFunc("/images/"+id, func(w http.ResponseWriter, r *http.Request) {
+			th.TestHeader(t, r, "X-Auth-Token", fakeclient.TokenID)
+
+			switch r.Method {
+			case "GET":
+				w.Header().Add("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, body)
+			case "PATCH":
+				calls.Updated = append(calls.Updated, id)
+				w.Header().Add("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, body)
+			case "DELETE":
+				calls.Deleted = append(calls.Deleted, id)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				t.Errorf("Unexpected request method %s for image %s", r.Method, id)
+			}
+		})
+	}
+
+	return calls
+}
+
+func imageID(t *testing.T, i imageEntry) string {
+	var img struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(i.JSON), &img); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return img.ID
+}
+
+func imageName(t *testing.T, i imageEntry) string {
+	var img struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(i.JSON), &img); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return img.Name
+}
+
+func imageIDs(imageList []images.Image) []string {
+	var ids []string
+	for _, img := range imageList {
+		ids = append(ids, img.ID)
+	}
+	return ids
 }
@@ -0,0 +1,164 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// ownerTeamProperty is the image property naming the team owning an image.
+const ownerTeamProperty = "owner_team"
+
+// The sort_by orders.
+const (
+	sortByCreatedAt      = "created_at"
+	sortByPropertyPrefix = "property:"
+)
+
+var defaultRemoveProperties = []string{"signature_verified"}
+
+// reservedProperties are the base image attributes managed by Glance, which
+// cannot be removed with a property update.
+var reservedProperties = map[string]bool{
+	"checksum":         true,
+	"container_format": true,
+	"created_at":       true,
+	"direct_url":       true,
+	"disk_format":      true,
+	"file":             true,
+	"id":               true,
+	"locations":        true,
+	"min_disk":         true,
+	"min_ram":          true,
+	"name":             true,
+	"os_hash_algo":     true,
+	"os_hash_value":    true,
+	"os_hidden":        true,
+	"owner":            true,
+	"protected":        true,
+	"schema":           true,
+	"self":             true,
+	"size":             true,
+	"status":           true,
+	"tags":             true,
+	"updated_at":       true,
+	"virtual_size":     true,
+	"visibility":       true,
+}
+
+// imageProperty returns the value of a custom image property as a string.
+func imageProperty(img images.Image, name string) (string, bool) {
+	v, ok := img.Properties[name]
+	if !ok || v == nil {
+		return "", false
+	}
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	return fmt.Sprint(v), true
+}
+
+// property returns the value of an image property, or else of the
+// name_pattern group of that name matched against the image name.
+func (p *OpenStackPostProcessor) property(img images.Image, name string) (string, bool) {
+	if v, ok := imageProperty(img, name); ok {
+		return v, true
+	}
+	re := p.config.namePattern
+	if re == nil {
+		return "", false
+	}
+	m := re.FindStringSubmatch(img.Name)
+	if m == nil {
+		return "", false
+	}
+	for i, group := range re.SubexpNames() {
+		if i > 0 && group == name {
+			return m[i], true
+		}
+	}
+	return "", false
+}
+
+// parseNamePattern compiles name_pattern, which must have named groups.
+func parseNamePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("name_pattern: %s", err)
+	}
+	for _, group := range re.SubexpNames() {
+		if group != "" {
+			return re, nil
+		}
+	}
+	return nil, fmt.Errorf("name_pattern %q has no named groups", pattern)
+}
+
+// comparePropertyValues compares two property values numerically when both
+// are integers, and as strings otherwise.
+func comparePropertyValues(a, b string) int {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	switch {
+	case errA != nil || errB != nil:
+		return strings.Compare(a, b)
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// isTruthy reports whether a property value means true.
+func isTruthy(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// imageCreatedAt returns the creation time of an image. Some Glance responses
+// omit created_at for old images, in which case updated_at is the best
+// approximation.
+func imageCreatedAt(img images.Image) time.Time {
+	if img.CreatedAt.IsZero() {
+		return img.UpdatedAt
+	}
+	return img.CreatedAt
+}
+
+// imageAge returns how long ago an image was created as a short human
+// readable string, such as "3d4h", or an empty string if it is unknown.
+func imageAge(img images.Image, now time.Time) string {
+	created := imageCreatedAt(img)
+	if created.IsZero() {
+		return ""
+	}
+	return formatAge(now.Sub(created))
+}
+
+// formatAge formats a duration with its two most significant units out of
+// days, hours and minutes.
+func formatAge(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
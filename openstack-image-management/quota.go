@@ -0,0 +1,53 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// quotaUsage is the limit and usage of a Glance quota. A negative limit
+// means unlimited.
+type quotaUsage struct {
+	Limit int64 `json:"limit"`
+	Usage int64 `json:"usage"`
+}
+
+// imageUsage returns the image quotas of the project and their usage from
+// the Glance usage API.
+func (p *OpenStackPostProcessor) imageUsage() (map[string]quotaUsage, error) {
+	var body struct {
+		Usage map[string]quotaUsage `json:"usage"`
+	}
+	err := p.withReauth(func() error {
+		_, err := p.conn.Get(p.conn.ServiceURL("info", "usage"), &body, nil)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image quota usage: %s", err)
+	}
+	return body.Usage, nil
+}
+
+// quotaProblems returns the image count and size quotas that would still
+// have no headroom after deleting the images.
+func quotaProblems(usage map[string]quotaUsage, deleted []images.Image) []string {
+	var bytes int64
+	for _, img := range deleted {
+		bytes += img.SizeBytes
+	}
+
+	var problems []string
+	if q, ok := usage["image_count_total"]; ok && q.Limit >= 0 {
+		if after := q.Usage - int64(len(deleted)); after >= q.Limit {
+			problems = append(problems, fmt.Sprintf("%d image(s) would remain for a quota of %d", after, q.Limit))
+		}
+	}
+	if q, ok := usage["image_size_total"]; ok && q.Limit >= 0 {
+		// The size quota is in MiB.
+		if after := q.Usage - bytes/(1024*1024); after >= q.Limit {
+			problems = append(problems, fmt.Sprintf("%d MiB would remain for a quota of %d MiB", after, q.Limit))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,63 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestQuotaProblems(t *testing.T) {
+	deleted := []images.Image{{ID: "a", SizeBytes: 300 * 1024 * 1024}, {ID: "b", SizeBytes: 200 * 1024 * 1024}}
+
+	usage := map[string]quotaUsage{
+		"image_count_total": {Limit: 10, Usage: 11},
+		"image_size_total":  {Limit: 1024, Usage: 1200},
+	}
+	if problems := quotaProblems(usage, deleted); len(problems) != 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+
+	usage["image_count_total"] = quotaUsage{Limit: 10, Usage: 12}
+	usage["image_size_total"] = quotaUsage{Limit: 1024, Usage: 1524}
+	problems := quotaProblems(usage, deleted)
+	if strings.Join(problems, "; ") != "10 image(s) would remain for a quota of 10; 1024 MiB would remain for a quota of 1024 MiB" {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+
+	usage["image_count_total"] = quotaUsage{Limit: -1, Usage: 100}
+	delete(usage, "image_size_total")
+	if problems := quotaProblems(usage, deleted); len(problems) != 0 {
+		t.Fatalf("unlimited quotas should have no problems: %v", problems)
+	}
+}
+
+func TestPostProcessorCheckQuota(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+	th.Mux.HandleFunc("/info/usage", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"usage": {"image_count_total": {"limit": 4, "usage": 5}, "image_size_total": {"limit": -1, "usage": 20}}}`)
+	})
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 2
+	p.config.CheckQuota = onFailureError
+	_, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{})
+	if err == nil || !strings.Contains(err.Error(), "4 image(s) would remain for a quota of 4") {
+		t.Fatalf("should fail without quota headroom: %v", err)
+	}
+	if len(calls.Deleted) != 0 {
+		t.Fatalf("should not delete anything: %v", calls.Deleted)
+	}
+}
@@ -0,0 +1,120 @@
+package openstackimagemanagement
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// recoveryImage is the metadata needed to recreate a placeholder of a
+// deleted image, in the terms of glance image-create.
+type recoveryImage struct {
+	ID              string                 `json:"id"`
+	Region          string                 `json:"region,omitempty"`
+	Name            string                 `json:"name"`
+	DiskFormat      string                 `json:"disk_format,omitempty"`
+	ContainerFormat string                 `json:"container_format,omitempty"`
+	MinDisk         int                    `json:"min_disk"`
+	MinRAM          int                    `json:"min_ram"`
+	Visibility      string                 `json:"visibility,omitempty"`
+	Tags            []string               `json:"tags"`
+	Properties      map[string]interface{} `json:"properties"`
+	Checksum        string                 `json:"checksum,omitempty"`
+	SizeBytes       int64                  `json:"size,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	DeletedAt       time.Time              `json:"deleted_at"`
+}
+
+func newRecoveryImage(img images.Image, region string, now time.Time) recoveryImage {
+	// Base attributes are fields of their own, or cannot be set.
+	properties := make(map[string]interface{})
+	for name, v := range img.Properties {
+		if !reservedProperties[name] {
+			properties[name] = v
+		}
+	}
+
+	tags := img.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return recoveryImage{
+		ID:              img.ID,
+		Region:          region,
+		Name:            img.Name,
+		DiskFormat:      img.DiskFormat,
+		ContainerFormat: img.ContainerFormat,
+		MinDisk:         img.MinDiskGigabytes,
+		MinRAM:          img.MinRAMMegabytes,
+		Visibility:      string(img.Visibility),
+		Tags:            tags,
+		Properties:      properties,
+		Checksum:        img.Checksum,
+		SizeBytes:       img.SizeBytes,
+		CreatedAt:       imageCreatedAt(img),
+		DeletedAt:       now.UTC(),
+	}
+}
+
+// readRecoveryManifest reads the images of an existing recovery_manifest. A
+// missing file has no images.
+func readRecoveryManifest(path string) ([]recoveryImage, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest map[string][]recoveryImage
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid recovery manifest %s: %s", path, err)
+	}
+	return manifest["images"], nil
+}
+
+// recordRecovery adds an image to the recovery manifest, replacing an earlier
+// record of the same image.
+func (p *OpenStackPostProcessor) recordRecovery(img recoveryImage) {
+	for i, recorded := range p.recovery {
+		if recorded.ID == img.ID {
+			p.recovery[i] = img
+			return
+		}
+	}
+	p.recovery = append(p.recovery, img)
+}
+
+// forgetRecovery removes an image that was not deleted after all from the
+// recovery manifest.
+func (p *OpenStackPostProcessor) forgetRecovery(id string) {
+	for i, recorded := range p.recovery {
+		if recorded.ID == id {
+			p.recovery = append(p.recovery[:i], p.recovery[i+1:]...)
+			return
+		}
+	}
+}
+
+// writeRecoveryManifest writes the images recorded so far to the
+// recovery_manifest.
+func (p *OpenStackPostProcessor) writeRecoveryManifest() error {
+	if err := writeRecoveryManifest(p.config.RecoveryManifest, p.recovery); err != nil {
+		return fmt.Errorf("failed to write recovery manifest %s: %s", p.config.RecoveryManifest, err)
+	}
+	return nil
+}
+
+// writeRecoveryManifest writes the recovery_manifest.
+func writeRecoveryManifest(path string, imgs []recoveryImage) error {
+	b, err := json.MarshalIndent(map[string][]recoveryImage{"images": imgs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
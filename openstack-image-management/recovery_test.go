@@ -0,0 +1,177 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessorRecoveryManifest(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "recovery")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.RecoveryManifest = filepath.Join(dir, "recovery.json")
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(p.config.RecoveryManifest)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var manifest struct {
+		Images []recoveryImage `json:"images"`
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(manifest.Images) != len(calls.Deleted) || len(manifest.Images) != 2 {
+		t.Fatalf("every deleted image should be recorded: %s", b)
+	}
+	img := manifest.Images[0]
+	if img.ID != "8c64f48a-45a3-4eaa-adff-a8106b6c005b" || img.Name != "packer-example" || img.DiskFormat != "ari" || img.ContainerFormat != "ari" || img.Visibility != "public" {
+		t.Fatalf("unexpected recovery metadata: %+v", img)
+	}
+	if img.Properties["hw_disk_bus"] != "scsi" {
+		t.Fatalf("properties should be recorded: %v", img.Properties)
+	}
+	for _, name := range []string{"size", "self", "file", "schema"} {
+		if _, ok := img.Properties[name]; ok {
+			t.Errorf("base attribute %s should not be a property", name)
+		}
+	}
+}
+
+func TestPostProcessorRecoveryManifestSkipsImagesInUse(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "recovery")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := ImageListHandler(t, imgs)
+	inUse := "/images/8c64f48a-45a3-4eaa-adff-a8106b6c005b"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" && r.URL.Path == inUse {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		th.Mux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	conn := fakeclient.ServiceClient()
+	conn.Endpoint = server.URL + "/"
+	p := OpenStackPostProcessor{conn: conn}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.TenantID = "cba624273b8344e59dd1fd18685183b0"
+	p.config.SweepOrphans = true
+	p.config.SweepOrphansOlderThan = 24 * time.Hour
+	p.config.Force = true
+	p.config.RecoveryManifest = filepath.Join(dir, "recovery.json")
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(p.config.RecoveryManifest)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var manifest struct {
+		Images []recoveryImage `json:"images"`
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var ids []string
+	for _, img := range manifest.Images {
+		ids = append(ids, img.ID)
+	}
+	sort.Strings(ids)
+	sort.Strings(calls.Deleted)
+	if strings.Join(ids, ",") != strings.Join(calls.Deleted, ",") || len(ids) != 3 {
+		t.Fatalf("only the deleted images, orphans included, should be recorded: %v, deleted %v", ids, calls.Deleted)
+	}
+}
+
+func TestPostProcessorRecoveryManifestResumed(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "recovery")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ImageListHandler(t, imgs)
+	interrupted := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if interrupted && r.Method == "DELETE" && r.URL.Path == "/images/e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		th.Mux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	run := func() error {
+		conn := fakeclient.ServiceClient()
+		conn.Endpoint = server.URL + "/"
+		p := OpenStackPostProcessor{conn: conn}
+		p.config.Identifier = "packer-example"
+		p.config.KeepReleases = 1
+		p.config.CheckpointFile = filepath.Join(dir, "checkpoint")
+		p.config.RecoveryManifest = filepath.Join(dir, "recovery.json")
+		_, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{})
+		return err
+	}
+	if err := run(); err == nil {
+		t.Fatal("the first run should be interrupted")
+	}
+	interrupted = false
+	if err := run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	recovery, err := readRecoveryManifest(filepath.Join(dir, "recovery.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var ids []string
+	for _, img := range recovery {
+		ids = append(ids, img.ID)
+	}
+	if strings.Join(ids, ",") != "8c64f48a-45a3-4eaa-adff-a8106b6c005b,e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4" {
+		t.Fatalf("the images deleted before the interruption should be kept: %v", ids)
+	}
+}
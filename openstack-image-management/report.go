@@ -0,0 +1,82 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/packer/packer"
+)
+
+type report struct {
+	Identifier string        `json:"identifier"`
+	Kept       int           `json:"kept"`
+	Deleted    int           `json:"deleted"`
+	Skipped    int           `json:"skipped"`
+	Actions    []imageAction `json:"actions"`
+}
+
+func newReport(identifier string, actions *actionEmitter) *report {
+	return &report{
+		Identifier: identifier,
+		Kept:       actions.Count(actionKeep),
+		Deleted:    actions.Count(actionDelete),
+		Skipped:    actions.Count(actionSkip),
+		Actions:    actions.actions,
+	}
+}
+
+// writeReport writes the report of a run as JSON.
+func writeReport(path string, r *report) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// reportRun writes the report of the run and runs the post_run_command with
+// it. Without a report_output, the command gets a temporary report.
+func (p *OpenStackPostProcessor) reportRun(ctx context.Context, ui packer.Ui, actions *actionEmitter) error {
+	r := newReport(strings.Join(p.families(), ","), actions)
+
+	path := p.config.ReportOutput
+	if path != "" {
+		ui.Message(fmt.Sprintf("Writing report: %s", path))
+	} else if len(p.config.PostRunCommand) > 0 {
+		f, err := ioutil.TempFile("", "packer-image-management-report-*.json")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		defer os.Remove(f.Name())
+		path = f.Name()
+	} else {
+		return nil
+	}
+
+	if err := writeReport(path, r); err != nil {
+		return err
+	}
+
+	if len(p.config.PostRunCommand) == 0 {
+		return nil
+	}
+
+	ui.Message(fmt.Sprintf("Running post_run_command: %s", strings.Join(p.config.PostRunCommand, " ")))
+	out, err := runPostRunCommand(ctx, p.config.PostRunCommand, path, r)
+	if out = strings.TrimSpace(out); out != "" {
+		ui.Message(out)
+	}
+	if err != nil {
+		if p.config.PostRunCommandOnFailure == onFailureWarn {
+			ui.Error(err.Error())
+			return nil
+		}
+		return err
+	}
+	return nil
+}
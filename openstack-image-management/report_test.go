@@ -0,0 +1,70 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+func TestReportRunPostRunCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	actions := &actionEmitter{}
+	actions.Emit(actionKeep, images.Image{ID: "a"}, "")
+	actions.Emit(actionDelete, images.Image{ID: "b"}, "")
+	actions.Emit(actionDelete, images.Image{ID: "c"}, "")
+
+	out := filepath.Join(dir, "out")
+	p := OpenStackPostProcessor{}
+	p.config.Identifier = "packer-example"
+	p.config.ReportOutput = filepath.Join(dir, "report.json")
+	p.config.PostRunCommand = []string{"sh", "-c", `echo "$PACKER_IMAGE_MANAGEMENT_DELETED $1" > ` + out, "sh"}
+	if err := p.reportRun(context.Background(), testUI(), actions); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(p.config.ReportOutput)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var r report
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if r.Kept != 1 || r.Deleted != 2 || len(r.Actions) != 3 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+
+	b, err = ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if strings.TrimSpace(string(b)) != "2 "+p.config.ReportOutput {
+		t.Fatalf("unexpected command output: %s", b)
+	}
+}
+
+func TestReportRunPostRunCommandFailure(t *testing.T) {
+	p := OpenStackPostProcessor{}
+	p.config.PostRunCommand = []string{"false"}
+	p.config.PostRunCommandOnFailure = onFailureError
+	actions := &actionEmitter{}
+	if err := p.reportRun(context.Background(), testUI(), actions); err == nil {
+		t.Fatal("should fail")
+	}
+
+	p.config.PostRunCommandOnFailure = onFailureWarn
+	if err := p.reportRun(context.Background(), testUI(), actions); err != nil {
+		t.Fatalf("should only warn: %s", err)
+	}
+}
@@ -0,0 +1,59 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// RetentionRule is a retention policy for the images whose property has a
+// value. The first matching rule of rules applies to an image, and images
+// matching none keep the other settings.
+type RetentionRule struct {
+	Property     string        `mapstructure:"property"`
+	Value        string        `mapstructure:"value"`
+	KeepReleases int           `mapstructure:"keep_releases"`
+	MaxAge       time.Duration `mapstructure:"max_age"`
+}
+
+func (r RetentionRule) String() string {
+	return fmt.Sprintf("%s=%s", r.Property, r.Value)
+}
+
+// ruleIndex returns the index of the first rule matching the image, or -1.
+func (p *OpenStackPostProcessor) ruleIndex(img images.Image) int {
+	for i, rule := range p.config.Rules {
+		if v, ok := p.property(img, rule.Property); ok && v == rule.Value {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectByRule selects the keep_releases newest images of a sorted group
+// that are not older than the max_age of the rule. With a max_age but no
+// keep_releases, every image within max_age is selected.
+func selectByRule(imageList []images.Image, rule RetentionRule, now time.Time) [][]string {
+	reasons := make([][]string, len(imageList))
+	reason := fmt.Sprintf("within keep_releases of rule %s", rule)
+	if rule.KeepReleases == 0 {
+		reason = fmt.Sprintf("within max_age of rule %s", rule)
+	}
+	if rule.KeepReleases == 0 && rule.MaxAge == 0 {
+		return reasons
+	}
+
+	n := 0
+	for i, img := range imageList {
+		if rule.KeepReleases > 0 && n >= rule.KeepReleases {
+			break
+		}
+		if rule.MaxAge > 0 && now.Sub(imageCreatedAt(img)) > rule.MaxAge {
+			continue
+		}
+		reasons[i] = append(reasons[i], reason)
+		n++
+	}
+	return reasons
+}
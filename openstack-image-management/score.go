@@ -0,0 +1,69 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// imageScores scores a group of images sorted newest first for
+// keep_by_score:
+//
+//	score = score_recency_weight * recency
+//	      + score_size_weight * smallness
+//	      + the score_property_weights of the properties the image has
+//
+// recency goes from 1 for the newest image down to 0 for the oldest one, and
+// smallness from 1 for an empty image down to 0 for the largest one.
+func (p *OpenStackPostProcessor) imageScores(imageList []images.Image) []float64 {
+	var largest int64
+	for _, img := range imageList {
+		if img.SizeBytes > largest {
+			largest = img.SizeBytes
+		}
+	}
+
+	scores := make([]float64, len(imageList))
+	for i, img := range imageList {
+		recency := 1.0
+		if len(imageList) > 1 {
+			recency = 1 - float64(i)/float64(len(imageList)-1)
+		}
+		smallness := 1.0
+		if largest > 0 {
+			smallness = 1 - float64(img.SizeBytes)/float64(largest)
+		}
+
+		score := p.config.ScoreRecencyWeight*recency + p.config.ScoreSizeWeight*smallness
+		for name, weight := range p.config.ScorePropertyWeights {
+			if v, ok := p.property(img, name); ok && v != "" {
+				score += weight
+			}
+		}
+		scores[i] = score
+	}
+	return scores
+}
+
+// selectByScore selects the keep images with the highest scores, the newest
+// first on equal scores.
+func (p *OpenStackPostProcessor) selectByScore(imageList []images.Image, reasons [][]string, keep int) {
+	scores := p.imageScores(imageList)
+
+	order := make([]int, len(imageList))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	for _, i := range order {
+		if keep <= 0 {
+			break
+		}
+		reasons[i] = append(reasons[i], fmt.Sprintf("score %.2f within keep_releases", scores[i]))
+		keep--
+	}
+}
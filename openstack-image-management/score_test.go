@@ -0,0 +1,38 @@
+package openstackimagemanagement
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+func TestPartitionImagesKeepByScore(t *testing.T) {
+	imageList := []images.Image{
+		{ID: "a", SizeBytes: 1000},
+		{ID: "b", SizeBytes: 200},
+		{ID: "c", SizeBytes: 1000, Properties: map[string]interface{}{"release": "1.0"}},
+		{ID: "d", SizeBytes: 100},
+		{ID: "e", SizeBytes: 1000},
+	}
+
+	p := OpenStackPostProcessor{}
+	p.config.KeepReleases = 3
+	p.config.KeepByScore = true
+	p.config.ScoreRecencyWeight = 1
+	p.config.ScoreSizeWeight = 0.5
+	p.config.ScorePropertyWeights = map[string]float64{"release": 2}
+	kept, expired, reasons := p.partitionImages(imageList, time.Now())
+
+	// a: 1, b: 0.75 + 0.4, c: 0.5 + 2, d: 0.25 + 0.45, e: 0
+	if ids := imageIDs(kept); strings.Join(ids, ",") != "a,b,c" {
+		t.Fatalf("unexpected kept images: %v", ids)
+	}
+	if ids := imageIDs(expired); strings.Join(ids, ",") != "d,e" {
+		t.Fatalf("unexpected expired images: %v", ids)
+	}
+	if r := strings.Join(reasons["c"], ", "); r != "score 2.50 within keep_releases" {
+		t.Fatalf("unexpected reasons: %s", r)
+	}
+}
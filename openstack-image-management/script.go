@@ -0,0 +1,40 @@
+package openstackimagemanagement
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// writeDeleteScript writes the shell script deleting the images for
+// delete_script_output, for an operator to review and run. Protected images
+// are left out.
+func writeDeleteScript(path string, imgs []images.Image, now time.Time) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Generated by the openstack-image-management post-processor at %s.\n", now.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "# Review the images before running it.\n")
+	fmt.Fprintf(&b, "set -e\n")
+
+	for _, img := range imgs {
+		// Names are quoted, so that they cannot break out of the comment.
+		fmt.Fprintf(&b, "\n# %s, created %s, %s old\n", strconv.Quote(img.Name), imageCreatedAt(img).UTC().Format(time.RFC3339), imageAge(img, now))
+		if img.Protected {
+			fmt.Fprintf(&b, "# Skipped, the image is protected: %s\n", strconv.Quote(img.ID))
+			continue
+		}
+		fmt.Fprintf(&b, "openstack image delete %s\n", shellQuote(img.ID))
+	}
+
+	return ioutil.WriteFile(path, b.Bytes(), 0755)
+}
+
+// shellQuote quotes a string for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,91 @@
+package openstackimagemanagement
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessorDeleteScriptOutput(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 1
+	p.config.DeleteScriptOutput = filepath.Join(dir, "delete.sh")
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 0 {
+		t.Fatalf("should not delete anything: %v", calls.Deleted)
+	}
+	b, err := ioutil.ReadFile(p.config.DeleteScriptOutput)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	script := string(b)
+	for _, id := range []string{"8c64f48a-45a3-4eaa-adff-a8106b6c005b", "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba4"} {
+		if !strings.Contains(script, "openstack image delete '"+id+"'\n") {
+			t.Errorf("script should delete %s:\n%s", id, script)
+		}
+	}
+	if strings.Contains(script, "07aa21a9-fa1a-430e-9a33-185be5982431") {
+		t.Errorf("script should not delete the kept image:\n%s", script)
+	}
+}
+
+func TestWriteDeleteScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 8, 5, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(dir, "delete.sh")
+	imgs := []images.Image{
+		{ID: "a'b", Name: "evil\nrm -rf /", CreatedAt: now.Add(-50 * time.Hour)},
+		{ID: "c", Name: "locked", CreatedAt: now.Add(-time.Hour), Protected: true},
+	}
+	if err := writeDeleteScript(path, imgs, now); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := `#!/bin/sh
+# Generated by the openstack-image-management post-processor at 2020-08-05T12:00:00Z.
+# Review the images before running it.
+set -e
+
+# "evil\nrm -rf /", created 2020-08-03T10:00:00Z, 2d2h old
+openstack image delete 'a'\''b'
+
+# "locked", created 2020-08-05T11:00:00Z, 1h0m old
+# Skipped, the image is protected: "c"
+`
+	if string(b) != expected {
+		t.Fatalf("unexpected script:\n%s", b)
+	}
+}
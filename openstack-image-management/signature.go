@@ -0,0 +1,161 @@
+package openstackimagemanagement
+
+import (
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA-224 and SHA-256
+	_ "crypto/sha512" // register SHA-384 and SHA-512
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	gopenstack "github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imagedata"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/openstack/keymanager/v1/secrets"
+)
+
+// The image properties used by Glance image signature verification.
+const (
+	signatureProperty            = "img_signature"
+	signatureHashMethodProperty  = "img_signature_hash_method"
+	signatureKeyTypeProperty     = "img_signature_key_type"
+	signatureCertificateProperty = "img_signature_certificate_uuid"
+)
+
+var signatureHashMethods = map[string]crypto.Hash{
+	"SHA-224": crypto.SHA224,
+	"SHA-256": crypto.SHA256,
+	"SHA-384": crypto.SHA384,
+	"SHA-512": crypto.SHA512,
+}
+
+// verifyImageSignature downloads an image and verifies its signature with
+// the signing certificate stored in Barbican, as Glance does on upload.
+func (p *OpenStackPostProcessor) verifyImageSignature(img images.Image) error {
+	props := make(map[string]string)
+	for _, name := range []string{signatureProperty, signatureHashMethodProperty, signatureKeyTypeProperty, signatureCertificateProperty} {
+		v, ok := imageProperty(img, name)
+		if !ok || v == "" {
+			return fmt.Errorf("image has no %s property", name)
+		}
+		props[name] = v
+	}
+
+	hash, ok := signatureHashMethods[props[signatureHashMethodProperty]]
+	if !ok {
+		return fmt.Errorf("unsupported hash method %s", props[signatureHashMethodProperty])
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(props[signatureProperty])
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", signatureProperty, err)
+	}
+
+	if p.keyManager == nil {
+		client, err := gopenstack.NewKeyManagerV1(p.conn.ProviderClient, gophercloud.EndpointOpts{
+			Region: p.config.Region,
+		})
+		if err != nil {
+			return err
+		}
+		p.keyManager = client
+	}
+
+	payload, err := secrets.GetPayload(p.keyManager, props[signatureCertificateProperty], secrets.GetPayloadOpts{
+		PayloadContentType: "application/octet-stream",
+	}).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to get certificate %s: %s", props[signatureCertificateProperty], err)
+	}
+	cert, err := parseCertificate(payload)
+	if err != nil {
+		return fmt.Errorf("invalid certificate %s: %s", props[signatureCertificateProperty], err)
+	}
+
+	body, err := imagedata.Download(p.conn, img.ID).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to download image data: %s", err)
+	}
+	defer body.Close()
+
+	h := hash.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return fmt.Errorf("failed to download image data: %s", err)
+	}
+
+	return verifySignature(cert.PublicKey, props[signatureKeyTypeProperty], hash, h.Sum(nil), signature)
+}
+
+// parseCertificate parses a DER or PEM encoded certificate.
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	return x509.ParseCertificate(data)
+}
+
+// verifySignature verifies the signature of a digest for one of the key
+// types supported by Glance.
+func verifySignature(pub crypto.PublicKey, keyType string, hash crypto.Hash, digest, signature []byte) error {
+	switch {
+	case keyType == "RSA-PSS":
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("certificate has no RSA key")
+		}
+		if err := rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}); err != nil {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	case keyType == "DSA":
+		key, ok := pub.(*dsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("certificate has no DSA key")
+		}
+		r, s, err := unmarshalDSASignature(signature)
+		if err != nil {
+			return err
+		}
+		if !dsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	case strings.HasPrefix(keyType, "ECC_"):
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("certificate has no ECC key")
+		}
+		r, s, err := unmarshalDSASignature(signature)
+		if err != nil {
+			return err
+		}
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %s", keyType)
+	}
+}
+
+// unmarshalDSASignature decodes the ASN.1 sequence of a DSA or ECDSA
+// signature.
+func unmarshalDSASignature(signature []byte) (*big.Int, *big.Int, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(signature, &sig)
+	if err != nil || len(rest) != 0 {
+		return nil, nil, fmt.Errorf("invalid signature encoding")
+	}
+	return sig.R, sig.S, nil
+}
@@ -0,0 +1,126 @@
+package openstackimagemanagement
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+)
+
+const (
+	testCertificateID = "fcd3b9e4-2a6e-4cd0-9e4c-0b6c8f1b3d88"
+	testImageData     = "image data"
+)
+
+func testCertificate(t *testing.T, key crypto.Signer) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "image signing"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return der
+}
+
+func signatureHandler(t *testing.T, imageID string, cert []byte) {
+	th.Mux.HandleFunc(fmt.Sprintf("/secrets/%s/payload", testCertificateID), func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		th.TestHeader(t, r, "Accept", "application/octet-stream")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(cert)
+	})
+	th.Mux.HandleFunc(fmt.Sprintf("/images/%s/file", imageID), func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, testImageData)
+	})
+}
+
+func signedImage(id, keyType string, signature []byte) images.Image {
+	return images.Image{
+		ID: id,
+		Properties: map[string]interface{}{
+			"img_signature":                  base64.StdEncoding.EncodeToString(signature),
+			"img_signature_hash_method":      "SHA-256",
+			"img_signature_key_type":         keyType,
+			"img_signature_certificate_uuid": testCertificateID,
+		},
+	}
+}
+
+func TestVerifyImageSignatureRSAPSS(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	signatureHandler(t, "07aa21a9-fa1a-430e-9a33-185be5982431", testCertificate(t, key))
+
+	digest := sha256.Sum256([]byte(testImageData))
+	signature, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient(), keyManager: fakeclient.ServiceClient()}
+	if err := p.verifyImageSignature(signedImage("07aa21a9-fa1a-430e-9a33-185be5982431", "RSA-PSS", signature)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	signature[0] ^= 0xff
+	err = p.verifyImageSignature(signedImage("07aa21a9-fa1a-430e-9a33-185be5982431", "RSA-PSS", signature))
+	if err == nil || !strings.Contains(err.Error(), "signature mismatch") {
+		t.Fatalf("should detect a mismatch: %v", err)
+	}
+}
+
+func TestVerifyImageSignatureECC(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	signatureHandler(t, "8c64f48a-45a3-4eaa-adff-a8106b6c005b", testCertificate(t, key))
+
+	digest := sha256.Sum256([]byte(testImageData))
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient(), keyManager: fakeclient.ServiceClient()}
+	if err := p.verifyImageSignature(signedImage("8c64f48a-45a3-4eaa-adff-a8106b6c005b", "ECC_SECP256R1", signature)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestVerifyImageSignatureMissingProperties(t *testing.T) {
+	var p OpenStackPostProcessor
+	err := p.verifyImageSignature(images.Image{ID: "07aa21a9-fa1a-430e-9a33-185be5982431"})
+	if err == nil || !strings.Contains(err.Error(), "no img_signature property") {
+		t.Fatalf("should require the signature properties: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// sendStatsd sends the metrics of a run to a StatsD server over UDP, one
+// metric per packet.
+func sendStatsd(address, prefix string, actions *actionEmitter, duration time.Duration) error {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if prefix != "" {
+		prefix += "."
+	}
+	metrics := []string{
+		fmt.Sprintf("%sdeleted:%d|c", prefix, actions.Count(actionDelete)),
+		fmt.Sprintf("%skept:%d|g", prefix, actions.Count(actionKeep)),
+		fmt.Sprintf("%sskipped:%d|g", prefix, actions.Count(actionSkip)),
+		fmt.Sprintf("%sbytes_reclaimed:%d|c", prefix, actions.DeletedBytes()),
+		fmt.Sprintf("%sduration:%d|ms", prefix, duration.Milliseconds()),
+	}
+	for _, m := range metrics {
+		if _, err := conn.Write([]byte(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package openstackimagemanagement
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+func TestSendStatsd(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer server.Close()
+
+	actions := &actionEmitter{}
+	actions.Emit(actionKeep, images.Image{ID: "a"}, "")
+	actions.Emit(actionDelete, images.Image{ID: "b", SizeBytes: 100}, "")
+	actions.Emit(actionDelete, images.Image{ID: "c", SizeBytes: 50}, "")
+
+	if err := sendStatsd(server.LocalAddr().String(), "images", actions, 1500*time.Millisecond); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var received []string
+	buf := make([]byte, 512)
+	for i := 0; i < 5; i++ {
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		received = append(received, string(buf[:n]))
+	}
+
+	expected := "images.deleted:2|c,images.kept:1|g,images.skipped:0|g,images.bytes_reclaimed:150|c,images.duration:1500|ms"
+	if strings.Join(received, ",") != expected {
+		t.Fatalf("unexpected metrics: %v", received)
+	}
+}
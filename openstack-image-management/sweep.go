@@ -0,0 +1,109 @@
+package openstackimagemanagement
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/hashicorp/packer/packer"
+)
+
+// sweepOrphans finds the images of the project that have no name or match no
+// family, and are older than sweep_orphans_older_than, leaving out those the
+// kept images require. They are only reported, unless force is set, in which
+// case they are returned to be deleted along with the expired images.
+func (p *OpenStackPostProcessor) sweepOrphans(ui packer.Ui, artifact packer.Artifact, kept []images.Image, now time.Time) ([]images.Image, error) {
+	project, err := p.projectID()
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []images.Image
+	err = p.withReauth(func() error {
+		orphans = nil
+		return images.List(p.conn, images.ListOpts{Owner: project}).EachPage(func(page pagination.Page) (bool, error) {
+			imgs, err := images.ExtractImages(page)
+			if err != nil {
+				return false, err
+			}
+			for _, img := range imgs {
+				if p.isOrphan(img, project, artifact, now) {
+					orphans = append(orphans, img)
+				}
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images of project %s: %s", project, err)
+	}
+
+	required, requiredBy := requiredImages(kept, orphans, p.config.RequiresImageProperty)
+	for _, img := range required {
+		ui.Message(fmt.Sprintf("Keeping orphaned image required by %s: %q %s", requiredBy[img.ID], img.Name, img.ID))
+	}
+	orphans = excludeImages(orphans, required)
+
+	if !p.config.Force {
+		for _, img := range orphans {
+			ui.Message(fmt.Sprintf("Found orphaned image, set force to delete it: %q %s (%s old)", img.Name, img.ID, imageAge(img, now)))
+		}
+		return nil, nil
+	}
+	for _, img := range orphans {
+		ui.Message(fmt.Sprintf("Found orphaned image to delete: %q %s (%s old)", img.Name, img.ID, imageAge(img, now)))
+	}
+	return orphans, nil
+}
+
+// isOrphan reports whether an image of the project is unnamed or matches no
+// family, is old enough, and is not protected, skipped or pending review.
+func (p *OpenStackPostProcessor) isOrphan(img images.Image, project string, artifact packer.Artifact, now time.Time) bool {
+	switch {
+	case img.Owner != project:
+		return false
+	case img.Name != "" && p.family(img) != "":
+		return false
+	case imageCreatedAt(img).IsZero() || now.Sub(imageCreatedAt(img)) < p.config.SweepOrphansOlderThan:
+		return false
+	case img.Protected:
+		log.Printf("Not sweeping protected image (%s)", img.ID)
+		return false
+	case artifact != nil && artifact.Id() == img.ID:
+		return false
+	}
+	if reason := p.skipReason(img); reason != "" {
+		log.Printf("Not sweeping skipped image (%s): %s", img.ID, reason)
+		return false
+	}
+	if reason := p.reviewReason(img); reason != "" {
+		log.Printf("Not sweeping image (%s): %s", img.ID, reason)
+		return false
+	}
+	return true
+}
+
+// protectedIDs returns the set of protected_ids.
+func (p *OpenStackPostProcessor) protectedIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, id := range p.config.ProtectedIDs {
+		ids[id] = true
+	}
+	return ids
+}
+
+// projectID returns the ID of the project the token is scoped to.
+func (p *OpenStackPostProcessor) projectID() (string, error) {
+	if result, ok := p.conn.ProviderClient.GetAuthResult().(tokens.CreateResult); ok {
+		if project, err := result.ExtractProject(); err == nil && project != nil && project.ID != "" {
+			return project.ID, nil
+		}
+	}
+	if p.config.TenantID != "" {
+		return p.config.TenantID, nil
+	}
+	return "", fmt.Errorf("cannot determine the project of the token, set tenant_id")
+}
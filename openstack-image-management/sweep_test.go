@@ -0,0 +1,127 @@
+package openstackimagemanagement
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	fakeclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/hashicorp/packer/packer"
+)
+
+func TestPostProcessorSweepOrphans(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		th.SetupHTTP()
+
+		calls := ImageListHandler(t, imgs)
+
+		p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+		p.config.Identifier = "packer-example"
+		p.config.KeepReleases = 3
+		p.config.TenantID = "cba624273b8344e59dd1fd18685183b0"
+		p.config.SweepOrphans = true
+		p.config.SweepOrphansOlderThan = 24 * time.Hour
+		p.config.Force = force
+		p.config.ProtectedIDs = []string{"8c64f48a-45a3-4eaa-adff-a8106b6c005v"}
+		ui := testUI()
+		if _, _, _, err := p.PostProcess(context.Background(), ui, &packer.MockArtifact{}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !force {
+			if len(calls.Deleted) != 0 {
+				t.Fatalf("orphans should only be reported without force: %v", calls.Deleted)
+			}
+			if out := ui.Writer.(*bytes.Buffer).String(); !strings.Contains(out, "Found orphaned image, set force to delete it: \"cirros-0.3.4-x86_64-uec-kernel\" e1b6edd4-bd9b-40ac-b010-8a6c16de4ba5") {
+				t.Fatalf("orphan should be reported:\n%s", out)
+			}
+		} else if len(calls.Deleted) != 1 || calls.Deleted[0] != "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba5" {
+			t.Fatalf("unexpected deleted images: %v", calls.Deleted)
+		}
+
+		th.TeardownHTTP()
+	}
+}
+
+func TestPostProcessorSweepOrphansKeepsRequiredOrphans(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	entries := append([]imageEntry{}, imgs...)
+	entries[0].JSON = strings.Replace(entries[0].JSON, `"signature_verified": "False"`, `"signature_verified": "False", "requires_image_id": "e1b6edd4-bd9b-40ac-b010-8a6c16de4ba5"`, 1)
+	calls := ImageListHandler(t, entries)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 3
+	p.config.RequiresImageProperty = "requires_image_id"
+	p.config.TenantID = "cba624273b8344e59dd1fd18685183b0"
+	p.config.SweepOrphans = true
+	p.config.SweepOrphansOlderThan = 24 * time.Hour
+	p.config.Force = true
+	p.config.ProtectedIDs = []string{"8c64f48a-45a3-4eaa-adff-a8106b6c005v"}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 0 {
+		t.Fatalf("an orphan required by a kept image should not be deleted: %v", calls.Deleted)
+	}
+}
+
+func TestPostProcessorSweepOrphansOutsideMaintenanceWindow(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	calls := ImageListHandler(t, imgs)
+
+	p := OpenStackPostProcessor{conn: fakeclient.ServiceClient()}
+	p.config.Identifier = "packer-example"
+	p.config.KeepReleases = 3
+	p.config.TenantID = "cba624273b8344e59dd1fd18685183b0"
+	p.config.SweepOrphans = true
+	p.config.SweepOrphansOlderThan = 24 * time.Hour
+	p.config.Force = true
+	p.config.window = &maintenanceWindow{}
+	if _, _, _, err := p.PostProcess(context.Background(), testUI(), &packer.MockArtifact{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(calls.Deleted) != 0 {
+		t.Fatalf("should not sweep outside of the maintenance window: %v", calls.Deleted)
+	}
+}
+
+func TestIsOrphan(t *testing.T) {
+	now := time.Date(2020, 8, 5, 12, 0, 0, 0, time.UTC)
+	var p OpenStackPostProcessor
+	p.config.Identifier = "packer-example"
+	p.config.SweepOrphansOlderThan = 24 * time.Hour
+	p.config.ProtectedIDs = []string{"listed"}
+	p.config.SkipIfPropertyEquals = map[string]string{"keep": "yes"}
+	p.config.ExcludeIfPropertyTruthy = []string{"review_required"}
+
+	cases := []struct {
+		img    images.Image
+		orphan bool
+	}{
+		{images.Image{ID: "unnamed", Owner: "project", CreatedAt: now.AddDate(0, 0, -2)}, true},
+		{images.Image{ID: "unmatched", Name: "snapshot", Owner: "project", CreatedAt: now.AddDate(0, 0, -2)}, true},
+		{images.Image{ID: "managed", Name: "packer-example", Owner: "project", CreatedAt: now.AddDate(0, 0, -2)}, false},
+		{images.Image{ID: "recent", Owner: "project", CreatedAt: now.Add(-time.Hour)}, false},
+		{images.Image{ID: "foreign", Owner: "other", CreatedAt: now.AddDate(0, 0, -2)}, false},
+		{images.Image{ID: "protected", Owner: "project", CreatedAt: now.AddDate(0, 0, -2), Protected: true}, false},
+		{images.Image{ID: "listed", Owner: "project", CreatedAt: now.AddDate(0, 0, -2)}, false},
+		{images.Image{ID: "skipped", Owner: "project", CreatedAt: now.AddDate(0, 0, -2), Properties: map[string]interface{}{"keep": "yes"}}, false},
+		{images.Image{ID: "review", Owner: "project", CreatedAt: now.AddDate(0, 0, -2), Properties: map[string]interface{}{"review_required": "true"}}, false},
+	}
+	for _, c := range cases {
+		if actual := p.isOrphan(c.img, "project", nil, now); actual != c.orphan {
+			t.Errorf("isOrphan(%s) = %t, expected %t", c.img.ID, actual, c.orphan)
+		}
+	}
+}
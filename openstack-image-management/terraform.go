@@ -0,0 +1,57 @@
+package openstackimagemanagement
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+const terraformImageResource = "openstack_images_image_v2"
+
+type terraformImport struct {
+	To string `json:"to"`
+	ID string `json:"id"`
+}
+
+// writeTerraformOutput writes the given images as Terraform import blocks.
+// A path ending in ".tf.json" is written in Terraform's JSON syntax,
+// anything else in native HCL syntax.
+func writeTerraformOutput(path string, imgs []images.Image) error {
+	var imports []terraformImport
+	for _, img := range imgs {
+		imports = append(imports, terraformImport{
+			To: terraformImageResource + "." + terraformResourceName(img.ID),
+			ID: img.ID,
+		})
+	}
+
+	var data []byte
+	if strings.HasSuffix(path, ".tf.json") {
+		b, err := json.MarshalIndent(map[string][]terraformImport{"import": imports}, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(b, '\n')
+	} else {
+		var buf bytes.Buffer
+		for i, imp := range imports {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "import {\n  to = %s\n  id = %q\n}\n", imp.To, imp.ID)
+		}
+		data = buf.Bytes()
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// terraformResourceName derives a stable resource name from an image ID.
+// Glance IDs are UUIDs, so replacing dashes is enough to get a valid identifier.
+func terraformResourceName(id string) string {
+	return "image_" + strings.ReplaceAll(id, "-", "_")
+}
@@ -0,0 +1,82 @@
+package openstackimagemanagement
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+func TestWriteTerraformOutputHCL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "images.tf")
+	kept := []images.Image{
+		{ID: "07aa21a9-fa1a-430e-9a33-185be5982431"},
+		{ID: "8c64f48a-45a3-4eaa-adff-a8106b6c005b"},
+	}
+	if err := writeTerraformOutput(path, kept); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := `import {
+  to = openstack_images_image_v2.image_07aa21a9_fa1a_430e_9a33_185be5982431
+  id = "07aa21a9-fa1a-430e-9a33-185be5982431"
+}
+
+import {
+  to = openstack_images_image_v2.image_8c64f48a_45a3_4eaa_adff_a8106b6c005b
+  id = "8c64f48a-45a3-4eaa-adff-a8106b6c005b"
+}
+`
+	if string(b) != expected {
+		t.Fatalf("unexpected output:\n%s", b)
+	}
+}
+
+func TestWriteTerraformOutputJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "images.tf.json")
+	kept := []images.Image{{ID: "07aa21a9-fa1a-430e-9a33-185be5982431"}}
+	if err := writeTerraformOutput(path, kept); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var out map[string][]terraformImport
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(out["import"]) != 1 {
+		t.Fatalf("expected 1 import, got %d", len(out["import"]))
+	}
+	if out["import"][0].ID != kept[0].ID {
+		t.Fatalf("unexpected id: %s", out["import"][0].ID)
+	}
+	if !strings.HasPrefix(out["import"][0].To, "openstack_images_image_v2.") {
+		t.Fatalf("unexpected address: %s", out["import"][0].To)
+	}
+}